@@ -0,0 +1,52 @@
+// cmd/reindex/main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/pkg/utils"
+)
+
+// reindex rebuilds the vector indexes of datasets, for example after loading
+// a large dataset that uses IVFFlat or after upgrading pgvector.
+func main() {
+	datasetId := flag.Int64("dataset", 0, "ID of the dataset to rebuild; all datasets when omitted")
+	flag.Parse()
+
+	if _, err := os.Stat(".env"); err == nil {
+		if err := utils.LoadDotenv(".env"); err != nil {
+			log.Fatalf("Error loading .env file: %v", err)
+		}
+	}
+
+	database, err := db.NewPostgresDB(os.Getenv("DB_CONNECTION_STRING"))
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	datasetIds := []int64{*datasetId}
+	if *datasetId == 0 {
+		datasetIds, err = database.DatasetIDs()
+		if err != nil {
+			log.Fatalf("Failed to list datasets: %v", err)
+		}
+	}
+
+	failed := false
+	for _, id := range datasetIds {
+		log.Printf("Rebuilding vector index of dataset %d", id)
+		if err := database.RebuildVectorIndex(id); err != nil {
+			log.Printf("Failed to rebuild vector index of dataset %d: %v", id, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	log.Printf("Rebuilt %d vector indexes", len(datasetIds))
+}
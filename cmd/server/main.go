@@ -2,16 +2,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mrhollen/KnowledgeGPT/internal/auth"
+	"github.com/mrhollen/KnowledgeGPT/internal/chunking"
 	"github.com/mrhollen/KnowledgeGPT/internal/db"
 	"github.com/mrhollen/KnowledgeGPT/internal/handlers"
+	"github.com/mrhollen/KnowledgeGPT/internal/jobs"
 	"github.com/mrhollen/KnowledgeGPT/internal/llm"
+	"github.com/mrhollen/KnowledgeGPT/internal/parsing"
+	"github.com/mrhollen/KnowledgeGPT/internal/rerank"
+	"github.com/mrhollen/KnowledgeGPT/internal/verify"
 	"github.com/mrhollen/KnowledgeGPT/pkg/utils"
 )
 
@@ -20,8 +28,13 @@ type Server struct {
 	Database              *db.PostgresDB
 	LLMClient             *llm.OpenAIClient
 	AccessTokenAuthorizer *auth.AccessTokenAuthorizer
+	IngestionWorker       *jobs.Worker
+	DatasetHandler        *handlers.DatasetHandler
 	DocumentHandler       *handlers.DocumentHandler
+	IndexHandler          *handlers.IndexHandler
+	JobHandler            *handlers.JobHandler
 	QueryHandler          *handlers.QueryHandler
+	SessionHandler        *handlers.SessionHandler
 	UploadHandler         *handlers.UploadHandler
 }
 
@@ -69,6 +82,10 @@ func initializeServer() (*Server, error) {
 
 	dbConnectionString := os.Getenv("DB_CONNECTION_STRING")
 
+	chunkSize := getEnvInt("CHUNK_SIZE", chunking.DefaultSize)
+	chunkOverlap := getEnvInt("CHUNK_OVERLAP", chunking.DefaultOverlap)
+	ingestWorkers := getEnvInt("INGEST_WORKERS", 2)
+
 	// Initialize Database
 	database, err := db.NewPostgresDB(dbConnectionString)
 	if err != nil {
@@ -77,38 +94,152 @@ func initializeServer() (*Server, error) {
 
 	// Initialize LLM Client
 	llmClient := llm.NewOpenAIClient(llmEndpoint, llmEmbeddingEndpoint, llmAPIKey, llmDefaultModel)
+	llmClient.EmbeddingBatchSize = getEnvInt("EMBEDDING_BATCH_SIZE", llm.DefaultEmbeddingBatchSize)
+	llmClient.EmbeddingBatchTokens = getEnvInt("EMBEDDING_BATCH_TOKENS", llm.DefaultEmbeddingBatchTokens)
+	llmClient.DefaultContextWindow = getEnvInt("LLM_CONTEXT_WINDOW", llm.DefaultContextWindow)
+	llmClient.AnswerReserveTokens = getEnvInt("LLM_ANSWER_RESERVE_TOKENS", llm.DefaultAnswerReserveTokens)
+	llmClient.ContextWindows, err = parseContextWindows(os.Getenv("LLM_CONTEXT_WINDOWS"))
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize Authorization
 	accessTokenAuthorizer := auth.NewAccessTokenAuthorizer(database)
 
 	// Initialize Handlers
 	docHandler := &handlers.DocumentHandler{
-		Client: llmClient,
-		DB:     database,
+		Client:  llmClient,
+		DB:      database,
+		Chunker: chunking.NewChunker(chunkSize, chunkOverlap),
+	}
+
+	// Start the background workers for asynchronous bulk ingestion
+	ingestionWorker := jobs.NewWorker(database, docHandler.IngestBatch, ingestWorkers)
+	ingestionWorker.Lease = time.Duration(getEnvInt("INGEST_LEASE_MINUTES", 15)) * time.Minute
+	ingestionWorker.MaxAttempts = getEnvInt("INGEST_MAX_ATTEMPTS", 5)
+	if err := ingestionWorker.Start(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to start ingestion workers: %w", err)
+	}
+	docHandler.Jobs = ingestionWorker
+
+	jobHandler := &handlers.JobHandler{
+		DB: database,
+	}
+	datasetHandler := &handlers.DatasetHandler{
+		DB: database,
+	}
+	indexHandler := &handlers.IndexHandler{
+		DB: database,
+	}
+	reranker, err := newReranker(llmClient)
+	if err != nil {
+		return nil, err
 	}
 	queryHandler := &handlers.QueryHandler{
-		DB:    database,
-		LLM:   llmClient,
-		Limit: 512,
+		DB:               database,
+		LLM:              llmClient,
+		Reranker:         reranker,
+		RerankCandidates: getEnvInt("RERANK_CANDIDATES", 20),
+		RerankTopK:       getEnvInt("RERANK_TOP_K", 5),
+		MaxLimit:         getEnvInt("QUERY_MAX_LIMIT", 50),
+		EfSearch:         getEnvInt("VECTOR_EF_SEARCH", 0),
+		Probes:           getEnvInt("VECTOR_PROBES", 0),
+		SessionHistory:   getEnvInt("SESSION_HISTORY_MESSAGES", 20),
+		ClaimChecker:     verify.NewClaimChecker(llmClient),
+	}
+	sessionHandler := &handlers.SessionHandler{
+		DB: database,
+	}
+	uploadHandler := &handlers.UploadHandler{
+		Documents: docHandler,
+		Parsers:   parsing.NewDefaultRegistry(),
 	}
-	uploadHandler := &handlers.UploadHandler{}
 
 	// Create and return the Server instance
 	return &Server{
 		Database:              database,
 		LLMClient:             llmClient,
 		AccessTokenAuthorizer: accessTokenAuthorizer,
+		IngestionWorker:       ingestionWorker,
+		DatasetHandler:        datasetHandler,
 		DocumentHandler:       docHandler,
+		IndexHandler:          indexHandler,
+		JobHandler:            jobHandler,
 		QueryHandler:          queryHandler,
+		SessionHandler:        sessionHandler,
 		UploadHandler:         uploadHandler,
 	}, nil
 }
 
+// newReranker creates the reranker selected by the RERANKER environment variable,
+// or returns nil when reranking is disabled
+func newReranker(llmClient llm.Client) (rerank.Reranker, error) {
+	switch os.Getenv("RERANKER") {
+	case "":
+		return nil, nil
+	case "http":
+		endpoint := os.Getenv("RERANK_ENDPOINT")
+		if endpoint == "" {
+			return nil, fmt.Errorf("RERANK_ENDPOINT is required when RERANKER is http")
+		}
+		return rerank.NewHTTPReranker(endpoint, os.Getenv("RERANK_API_KEY"), os.Getenv("RERANK_MODEL")), nil
+	case "llm":
+		return rerank.NewLLMReranker(llmClient, os.Getenv("RERANK_MODEL")), nil
+	default:
+		return nil, fmt.Errorf("unknown reranker: %s", os.Getenv("RERANKER"))
+	}
+}
+
+// parseContextWindows reads per-model context windows written as
+// "model=tokens,model=tokens"
+func parseContextWindows(value string) (map[string]int, error) {
+	windows := map[string]int{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		model, tokens, found := strings.Cut(entry, "=")
+		window, err := strconv.Atoi(strings.TrimSpace(tokens))
+		if !found || err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid LLM_CONTEXT_WINDOWS entry: %s", entry)
+		}
+		windows[strings.TrimSpace(model)] = window
+	}
+
+	return windows, nil
+}
+
+// getEnvInt reads an integer environment variable, returning fallback when it is unset or invalid
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d: %v", name, fallback, err)
+		return fallback
+	}
+
+	return parsed
+}
+
 // registerRoutes sets up all the HTTP routes with their respective handlers
 func (s *Server) registerRoutes() {
 	http.HandleFunc("/documents", s.enableCORS(s.handleDocuments))
+	http.HandleFunc("/documents/{id}", s.enableCORS(s.handleDocument))
 	http.HandleFunc("/bulk/documents", s.enableCORS(s.handleBulkDocuments))
+	http.HandleFunc("/datasets", s.enableCORS(s.handleDatasets))
+	http.HandleFunc("/datasets/{name}", s.enableCORS(s.handleDataset))
+	http.HandleFunc("/jobs/{id}", s.enableCORS(s.handleJob))
+	http.HandleFunc("/admin/indexes", s.enableCORS(s.handleIndexes))
+	http.HandleFunc("/admin/indexes/{dataset}/rebuild", s.enableCORS(s.handleIndexRebuild))
 	http.HandleFunc("/query", s.enableCORS(s.handleQuery))
+	http.HandleFunc("/sessions", s.enableCORS(s.handleSessions))
+	http.HandleFunc("/sessions/{id}", s.enableCORS(s.handleSession))
 	http.HandleFunc("/upload", s.enableCORS(s.handleUpload))
 }
 
@@ -117,7 +248,7 @@ func (s *Server) enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 
 		// Handle preflight requests
@@ -133,35 +264,114 @@ func (s *Server) enableCORS(next http.HandlerFunc) http.HandlerFunc {
 
 // handleDocuments handles requests to the /documents endpoint
 func (s *Server) handleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.ListDocuments(userId, w, r)
+		}
+	case http.MethodPost:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.AddDocument(userId, w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDocument handles requests to the /documents/{id} endpoint
+func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.GetDocument(userId, w, r)
+		}
+	case http.MethodPut:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.UpdateDocument(userId, false, w, r)
+		}
+	case http.MethodPatch:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.UpdateDocument(userId, true, w, r)
+		}
+	case http.MethodDelete:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.DeleteDocument(userId, w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBulkDocuments handles requests to the /bulk/documents endpoint
+func (s *Server) handleBulkDocuments(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		isAuthorized, userId, err := s.checkAccessToken(r)
-		if !isAuthorized || err != nil {
-			if err != nil {
-				log.Println(err)
-			}
-			http.Error(w, "", http.StatusUnauthorized)
-			return
+		if userId, ok := s.authorize(w, r); ok {
+			s.DocumentHandler.AddDocuments(userId, w, r)
 		}
+		return
+	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
 
-		s.DocumentHandler.AddDocument(userId, w, r)
+// handleDatasets handles requests to the /datasets endpoint
+func (s *Server) handleDatasets(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if userId, ok := s.authorize(w, r); ok {
+			s.DatasetHandler.ListDatasets(userId, w, r)
+		}
 		return
 	}
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-// handleBulkDocuments handles requests to the /bulk/documents endpoint
-func (s *Server) handleBulkDocuments(w http.ResponseWriter, r *http.Request) {
+// handleDataset handles requests to the /datasets/{name} endpoint
+func (s *Server) handleDataset(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DatasetHandler.GetDataset(userId, w, r)
+		}
+	case http.MethodPatch:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DatasetHandler.UpdateDataset(userId, w, r)
+		}
+	case http.MethodDelete:
+		if userId, ok := s.authorize(w, r); ok {
+			s.DatasetHandler.DeleteDataset(userId, w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleIndexes handles requests to the /admin/indexes endpoint
+func (s *Server) handleIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if userId, ok := s.authorizeAdmin(w, r); ok {
+			s.IndexHandler.ListIndexes(userId, w, r)
+		}
+		return
+	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// handleIndexRebuild handles requests to the /admin/indexes/{dataset}/rebuild endpoint
+func (s *Server) handleIndexRebuild(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		isAuthorized, userId, err := s.checkAccessToken(r)
-		if !isAuthorized || err != nil {
-			if err != nil {
-				log.Println(err)
-			}
-			http.Error(w, "", http.StatusUnauthorized)
-			return
+		if userId, ok := s.authorizeAdmin(w, r); ok {
+			s.IndexHandler.RebuildIndex(userId, w, r)
 		}
+		return
+	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
 
-		s.DocumentHandler.AddDocuments(userId, w, r)
+// handleJob handles requests to the /jobs/{id} endpoint
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if userId, ok := s.authorize(w, r); ok {
+			s.JobHandler.GetJob(userId, w, r)
+		}
 		return
 	}
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -171,25 +381,44 @@ func (s *Server) handleBulkDocuments(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		isAuthorized, userId, err := s.checkAccessToken(r)
-		if !isAuthorized || err != nil {
-			if err != nil {
-				log.Println(err)
-			}
-			http.Error(w, "", http.StatusUnauthorized)
-			return
+		if userId, ok := s.authorize(w, r); ok {
+			s.QueryHandler.SimpleQuery(userId, w, r)
 		}
-		s.QueryHandler.SimpleQuery(userId, w, r)
 	case http.MethodPost:
-		isAuthorized, userId, err := s.checkAccessToken(r)
-		if !isAuthorized || err != nil {
-			if err != nil {
-				log.Println(err)
-			}
-			http.Error(w, "", http.StatusUnauthorized)
-			return
+		if userId, ok := s.authorize(w, r); ok {
+			s.QueryHandler.QueryWithLLM(userId, w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSessions handles requests to the /sessions endpoint
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if userId, ok := s.authorize(w, r); ok {
+			s.SessionHandler.ListSessions(userId, w, r)
+		}
+		return
+	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// handleSession handles requests to the /sessions/{id} endpoint
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if userId, ok := s.authorize(w, r); ok {
+			s.SessionHandler.GetSession(userId, w, r)
+		}
+	case http.MethodPatch:
+		if userId, ok := s.authorize(w, r); ok {
+			s.SessionHandler.UpdateSession(userId, w, r)
+		}
+	case http.MethodDelete:
+		if userId, ok := s.authorize(w, r); ok {
+			s.SessionHandler.DeleteSession(userId, w, r)
 		}
-		s.QueryHandler.QueryWithLLM(userId, w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -198,21 +427,50 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 // handleUpload handles requests to the /upload endpoint
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		isAuthorized, userId, err := s.checkAccessToken(r)
-		if !isAuthorized || err != nil {
-			if err != nil {
-				log.Println(err)
-			}
-			http.Error(w, "", http.StatusUnauthorized)
-			return
+		if userId, ok := s.authorize(w, r); ok {
+			s.UploadHandler.UploadFile(userId, w, r)
 		}
-
-		s.UploadHandler.UploadFile(userId, w, r)
 		return
 	}
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
+// authorize checks the request's access token, responding with 401 Unauthorized
+// when it is missing or invalid. It returns the ID of the token's user.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	isAuthorized, userId, err := s.checkAccessToken(r)
+	if !isAuthorized || err != nil {
+		if err != nil {
+			log.Println(err)
+		}
+		http.Error(w, "", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	return userId, true
+}
+
+// authorizeAdmin is like authorize, but also responds with 403 Forbidden when
+// the token's user is not an admin.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userId, ok := s.authorize(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	isAdmin, _, err := s.AccessTokenAuthorizer.CheckAdminToken(token)
+	if !isAdmin || err != nil {
+		if err != nil {
+			log.Println(err)
+		}
+		http.Error(w, "", http.StatusForbidden)
+		return 0, false
+	}
+
+	return userId, true
+}
+
 // checkAccessToken verifies the Authorization header and validates the token
 func (s *Server) checkAccessToken(r *http.Request) (bool, int64, error) {
 	authHeader := r.Header.Get("Authorization")
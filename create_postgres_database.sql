@@ -3,37 +3,109 @@ CREATE EXTENSION IF NOT EXISTS vector;
 CREATE TABLE sessions (
 	id text NOT NULL,
 	user_id int4 NOT NULL,
-	messages _text NOT NULL,
+	title text NULL,
 	model text NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	updated_at timestamp DEFAULT now() NOT NULL,
 	CONSTRAINT sessions_pkey PRIMARY KEY (id)
 );
 
+CREATE INDEX sessions_user_id_idx ON sessions (user_id, updated_at);
+
+CREATE TABLE session_messages (
+	id serial4 NOT NULL,
+	session_id text NOT NULL,
+	"role" text NOT NULL,
+	"content" text NOT NULL,
+	document_ids _int4 DEFAULT '{}' NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT session_messages_pkey PRIMARY KEY (id),
+	CONSTRAINT session_messages_role_check CHECK (role IN ('user', 'assistant')),
+	CONSTRAINT session_messages_sessions_fk 
+		FOREIGN KEY (session_id) 
+		REFERENCES sessions(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX session_messages_session_id_idx ON session_messages (session_id, id);
+
 CREATE TABLE datasets (
 	id serial4 NOT NULL,
 	user_id int4 NOT NULL,
 	"name" text NOT NULL,
+	description text NULL,
+	distance_metric text DEFAULT 'l2' NOT NULL,
+	vector_index_type text DEFAULT 'hnsw' NOT NULL,
+	vector_dimensions int4 NULL,
+	hyde_mode text DEFAULT 'off' NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
 	CONSTRAINT datasets_pkey PRIMARY KEY (id),
-	CONSTRAINT datasets_unique UNIQUE (name, user_id)
+	CONSTRAINT datasets_unique UNIQUE (name, user_id),
+	CONSTRAINT datasets_distance_metric_check CHECK (distance_metric IN ('l2', 'cosine', 'inner_product')),
+	CONSTRAINT datasets_vector_index_type_check CHECK (vector_index_type IN ('hnsw', 'ivfflat', 'none')),
+	CONSTRAINT datasets_hyde_mode_check CHECK (hyde_mode IN ('off', 'hypothetical', 'average'))
 );
 
 CREATE TABLE documents (
 	id serial4 NOT NULL,
 	dataset_id int4 NOT NULL,
+	external_id text NULL,
 	title text NOT NULL,
 	url text NULL,
 	body text NOT NULL,
-	vector public.vector NOT NULL,
+	metadata jsonb DEFAULT '{}'::jsonb NOT NULL,
+	content_hash text NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	updated_at timestamp DEFAULT now() NOT NULL,
+	title_tsv tsvector GENERATED ALWAYS AS (setweight(to_tsvector('english', title), 'A')) STORED,
 	CONSTRAINT documents_pkey PRIMARY KEY (id),
+	CONSTRAINT documents_external_id_unique UNIQUE (dataset_id, external_id),
 	CONSTRAINT documents_datasets_fk 
 		FOREIGN KEY (dataset_id) 
 		REFERENCES datasets(id) 
 		ON DELETE CASCADE ON UPDATE CASCADE
 );
 
+CREATE UNIQUE INDEX documents_content_hash_unique 
+	ON documents (dataset_id, content_hash);
+
+CREATE INDEX documents_metadata_idx ON documents USING gin (metadata);
+
+CREATE INDEX documents_title_tsv_idx ON documents USING gin (title_tsv);
+
+CREATE TABLE chunks (
+	id serial4 NOT NULL,
+	document_id int4 NOT NULL,
+	dataset_id int4 NOT NULL,
+	chunk_index int4 NOT NULL,
+	body text NOT NULL,
+	token_count int4 NULL,
+	vector public.vector NOT NULL,
+	tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', body)) STORED,
+	CONSTRAINT chunks_pkey PRIMARY KEY (id),
+	CONSTRAINT chunks_unique UNIQUE (document_id, chunk_index),
+	CONSTRAINT chunks_documents_fk 
+		FOREIGN KEY (document_id) 
+		REFERENCES documents(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT chunks_datasets_fk 
+		FOREIGN KEY (dataset_id) 
+		REFERENCES datasets(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX chunks_tsv_idx ON chunks USING gin (tsv);
+
+-- Each dataset's vector index is managed by the server as
+-- chunks_vector_dataset_<id>_idx. HNSW indexes are created once the dimensions
+-- of the dataset's embeddings are known; IVFFlat indexes are built by the
+-- reindex command or the /admin/indexes/{dataset}/rebuild endpoint.
+
 CREATE TABLE users (
 	id serial4 NOT NULL,
 	username text NOT NULL,
 	active bool DEFAULT false NOT NULL,
+	is_admin bool DEFAULT false NOT NULL,
 	CONSTRAINT users_pkey PRIMARY KEY (id),
 	CONSTRAINT users_username_key UNIQUE (username)
 );
@@ -48,4 +120,30 @@ CREATE TABLE access_tokens (
 	CONSTRAINT access_tokens_users_fk 
 		FOREIGN KEY (user_id) 
 		REFERENCES users(id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE ingestion_jobs (
+	id text NOT NULL,
+	user_id int4 NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT ingestion_jobs_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE ingestion_job_items (
+	job_id text NOT NULL,
+	item_index int4 NOT NULL,
+	payload jsonb NOT NULL,
+	status text DEFAULT 'pending' NOT NULL,
+	error text NULL,
+	document_id int4 NULL,
+	claimed_at timestamp NULL,
+	attempts int4 DEFAULT 0 NOT NULL,
+	retry_at timestamp NULL,
+	CONSTRAINT ingestion_job_items_pkey PRIMARY KEY (job_id, item_index),
+	CONSTRAINT ingestion_job_items_jobs_fk 
+		FOREIGN KEY (job_id) 
+		REFERENCES ingestion_jobs(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX ingestion_job_items_status_idx ON ingestion_job_items (status);
\ No newline at end of file
@@ -7,4 +7,13 @@ require (
 	github.com/pgvector/pgvector-go v0.2.2
 )
 
-require github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
+require (
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+)
+
+require (
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+)
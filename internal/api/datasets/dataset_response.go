@@ -0,0 +1,18 @@
+package api
+
+import "time"
+
+type DatasetResponse struct {
+	Name           string    `json:"name"`
+	Description    string    `json:"description,omitempty"`
+	DistanceMetric string    `json:"distance_metric"`
+	IndexType      string    `json:"index_type"`
+	HyDEMode       string    `json:"hyde_mode"`
+	DocumentCount  int       `json:"document_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastUpdated    time.Time `json:"last_updated"`
+}
+
+type ListDatasetsResponse struct {
+	Datasets []DatasetResponse `json:"datasets"`
+}
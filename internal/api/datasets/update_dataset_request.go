@@ -0,0 +1,10 @@
+package api
+
+// UpdateDatasetRequest changes only the fields that are present.
+type UpdateDatasetRequest struct {
+	Name           *string `json:"name,omitempty"`
+	Description    *string `json:"description,omitempty"`
+	DistanceMetric *string `json:"distance_metric,omitempty"`
+	IndexType      *string `json:"index_type,omitempty"`
+	HyDEMode       *string `json:"hyde_mode,omitempty"`
+}
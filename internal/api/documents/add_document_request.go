@@ -5,4 +5,9 @@ type AddDocumentRequest struct {
 	URL     string `json:"url,omitempty"`
 	Body    string `json:"body"`
 	Dataset string `json:"dataset"`
+	// Metadata holds arbitrary attributes that searches can filter on
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// ExternalID optionally identifies the document in the client's own system.
+	// Posting new content under an existing ExternalID replaces the document.
+	ExternalID string `json:"external_id,omitempty"`
 }
@@ -0,0 +1,16 @@
+package api
+
+const (
+	StatusCreated   = "created"
+	StatusUpdated   = "updated"
+	StatusUnchanged = "unchanged"
+	// StatusFailed marks a document of a bulk request that was rejected
+	StatusFailed = "failed"
+)
+
+type AddDocumentResponse struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	// Error explains why the document was rejected, when Status is StatusFailed
+	Error string `json:"error,omitempty"`
+}
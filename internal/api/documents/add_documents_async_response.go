@@ -0,0 +1,5 @@
+package api
+
+type AddDocumentsAsyncResponse struct {
+	JobID string `json:"job_id"`
+}
@@ -0,0 +1,19 @@
+package api
+
+import "time"
+
+type DocumentResponse struct {
+	ID         int64          `json:"id"`
+	Dataset    string         `json:"dataset"`
+	ExternalID string         `json:"external_id,omitempty"`
+	Title      string         `json:"title"`
+	URL        string         `json:"url,omitempty"`
+	Body       string         `json:"body,omitempty"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+type ListDocumentsResponse struct {
+	Documents []DocumentResponse `json:"documents"`
+}
@@ -0,0 +1,11 @@
+package api
+
+// UpdateDocumentRequest is used for both PUT and PATCH. PUT requires the title
+// and body while PATCH only changes the fields that are present.
+type UpdateDocumentRequest struct {
+	Title *string `json:"title,omitempty"`
+	URL   *string `json:"url,omitempty"`
+	Body  *string `json:"body,omitempty"`
+	// Metadata replaces the stored metadata when present
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
@@ -0,0 +1,16 @@
+package api
+
+type IndexResponse struct {
+	Dataset    string `json:"dataset"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Metric     string `json:"metric"`
+	Dimensions int    `json:"dimensions,omitempty"`
+	Chunks     int    `json:"chunks"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Status     string `json:"status"`
+}
+
+type ListIndexesResponse struct {
+	Indexes []IndexResponse `json:"indexes"`
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+var filterOperators = map[string]bool{
+	models.FilterEqual:        true,
+	models.FilterIn:           true,
+	models.FilterGreater:      true,
+	models.FilterGreaterEqual: true,
+	models.FilterLess:         true,
+	models.FilterLessEqual:    true,
+}
+
+// MetadataFilters is decoded from an object mapping metadata keys to either a
+// value to match exactly or an object of operators, for example:
+//
+//	{"author": "alice", "version": {"in": ["1.2", "1.3"]}, "published": {"gte": "2024-01-01"}}
+type MetadataFilters []models.MetadataFilter
+
+func (f *MetadataFilters) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("filters must be an object: %w", err)
+	}
+
+	// Sort the keys so the same filters always produce the same query
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := MetadataFilters{}
+	for _, key := range keys {
+		operators, ok := raw[key].(map[string]any)
+		if !ok || !isOperatorObject(operators) {
+			filters = append(filters, models.MetadataFilter{Key: key, Op: models.FilterEqual, Value: raw[key]})
+			continue
+		}
+
+		ops := make([]string, 0, len(operators))
+		for op := range operators {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+
+		for _, op := range ops {
+			filters = append(filters, models.MetadataFilter{Key: key, Op: op, Value: operators[op]})
+		}
+	}
+
+	*f = filters
+	return nil
+}
+
+// isOperatorObject reports whether every key of an object is a filter operator.
+// Other objects are matched by equality.
+func isOperatorObject(value map[string]any) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for key := range value {
+		if !filterOperators[key] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,9 +1,51 @@
 package api
 
+// Formats of the answer of POST /query
+const (
+	// FormatText replaces citations with the number of the source in brackets
+	FormatText = "text"
+	// FormatMarkdown replaces citations with markdown links to the documents
+	FormatMarkdown = "markdown"
+)
+
 type QueryRequest struct {
-	Query     string `json:"query"`
+	Query string `json:"query"`
+	// SessionID continues a conversation; a new session is started without it
 	SessionID string `json:"session_id"`
 	Limit     *int   `json:"limit,omitempty"`
 	Model     string `json:"model"`
 	Dataset   string `json:"dataset"`
+	// Datasets are searched together with Dataset. "*" searches every dataset.
+	Datasets []string        `json:"datasets,omitempty"`
+	Filters  MetadataFilters `json:"filters,omitempty"`
+	Mode     string          `json:"mode,omitempty"`
+	// MinScore drops vector matches less similar to the query
+	MinScore *float64 `json:"min_score,omitempty"`
+	// EfSearch and Probes override the vector index search settings
+	EfSearch int `json:"ef_search,omitempty"`
+	Probes   int `json:"probes,omitempty"`
+	// MMR diversifies the search results with maximal marginal relevance
+	MMR bool `json:"mmr,omitempty"`
+	// Lambda weighs relevance against diversity for MMR, from 0 to 1
+	Lambda *float64 `json:"lambda,omitempty"`
+	// HyDE embeds a hypothetical answer instead of the query: "off",
+	// "hypothetical" or "average". Empty uses the datasets' default.
+	HyDE string `json:"hyde,omitempty"`
+	// Rerank rescores an enlarged candidate set with the configured reranker
+	Rerank bool `json:"rerank,omitempty"`
+	// RerankTopK is the number of reranked candidates kept for the prompt
+	RerankTopK *int `json:"rerank_top_k,omitempty"`
+	// Rewrite has the LLM turn the query into standalone search queries
+	Rewrite bool `json:"rewrite,omitempty"`
+	// RewriteCount is the maximum number of search queries generated
+	RewriteCount *int `json:"rewrite_count,omitempty"`
+	// Format is FormatText or FormatMarkdown; defaults to FormatText
+	Format string `json:"format,omitempty"`
+	// Stream sends the answer as server-sent events while it is generated
+	Stream bool `json:"stream,omitempty"`
+	// Verify checks the citations of the answer and reports uncited sentences
+	Verify bool `json:"verify,omitempty"`
+	// VerifyClaims also asks the LLM whether each cited document supports the
+	// sentence citing it. Implies Verify.
+	VerifyClaims bool `json:"verify_claims,omitempty"`
 }
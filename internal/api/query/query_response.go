@@ -2,4 +2,94 @@ package api
 
 type QueryResponse struct {
 	Response string `json:"response"`
+	// Sources are the documents given to the LLM, in the order they are numbered
+	Sources []Source `json:"sources"`
+	// Citations are the positions of the citations in Response
+	Citations []Citation `json:"citations"`
+	// SessionID continues the conversation when sent with the next query
+	SessionID string `json:"session_id"`
+	// SearchQueries are the rewritten queries used for retrieval, when rewriting was requested
+	SearchQueries []string `json:"search_queries,omitempty"`
+	// HypotheticalAnswers are the answers embedded for retrieval, when HyDE was used
+	HypotheticalAnswers []string `json:"hypothetical_answers,omitempty"`
+	// Verification reports how well the answer is backed by its sources, when requested
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Source is a document that was given to the LLM to answer the query
+type Source struct {
+	ID      int64   `json:"id"`
+	Dataset string  `json:"dataset"`
+	Title   string  `json:"title"`
+	URL     string  `json:"url,omitempty"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+	// Cited reports whether the answer cites the document
+	Cited bool `json:"cited"`
+}
+
+// Citation is a citation in the answer, in characters from the start of the
+// text. Source is the index of the cited document in the sources.
+type Citation struct {
+	Source int `json:"source"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+}
+
+// Verification reports how well an answer is backed by its sources
+type Verification struct {
+	// Verified is true when every sentence making a claim cites a document and
+	// every citation points at a source. When claims are checked, every cited
+	// claim must also have been checked and found supported
+	Verified bool `json:"verified"`
+	// Sentences is the number of sentences making a claim, of which
+	// CitedSentences cite a document
+	Sentences      int `json:"sentences"`
+	CitedSentences int `json:"cited_sentences"`
+	// UncitedSentences make a claim without citing a document
+	UncitedSentences []string `json:"uncited_sentences"`
+	// UnknownCitations cite documents that were not given to the LLM
+	UnknownCitations []UnknownCitation `json:"unknown_citations"`
+	// Claims are the cited sentences checked against their sources, when requested
+	Claims []ClaimCheck `json:"claims,omitempty"`
+	// ClaimsSkipped is the number of cited claims left unchecked because of the
+	// limit on checks per answer
+	ClaimsSkipped int `json:"claims_skipped,omitempty"`
+}
+
+// UnknownCitation is a citation of a document that is not a source
+type UnknownCitation struct {
+	DocumentID int64  `json:"document_id"`
+	Sentence   string `json:"sentence"`
+}
+
+// ClaimCheck is the outcome of checking a sentence against a source it cites.
+// Source is the index of the document in the sources, and Verdict is
+// "supported", "unsupported" or "unknown" when the LLM gave no usable reply.
+type ClaimCheck struct {
+	Sentence    string `json:"sentence"`
+	Source      int    `json:"source"`
+	Verdict     string `json:"verdict"`
+	Explanation string `json:"explanation"`
+}
+
+// StreamToken is the data of a "token" event of a streamed answer
+type StreamToken struct {
+	Text string `json:"text"`
+	// Citations are the positions of the citations in Text
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// StreamDone is the data of the "done" event that ends a streamed answer
+type StreamDone struct {
+	SessionID           string        `json:"session_id"`
+	Sources             []Source      `json:"sources"`
+	SearchQueries       []string      `json:"search_queries,omitempty"`
+	HypotheticalAnswers []string      `json:"hypothetical_answers,omitempty"`
+	Verification        *Verification `json:"verification,omitempty"`
+}
+
+// StreamError is the data of the "error" event that ends a failed stream
+type StreamError struct {
+	Error string `json:"error"`
 }
@@ -1,7 +1,21 @@
 package api
 
 type SimpleQueryRequest struct {
-	Query   string `json:"query"`
-	Limit   int    `json:"limit"`
-	Dataset string `json:"dataset"`
+	Query    string          `json:"query"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+	Datasets []string        `json:"datasets"`
+	Filters  MetadataFilters `json:"filters,omitempty"`
+	Mode     string          `json:"mode,omitempty"`
+	MinScore *float64        `json:"min_score,omitempty"`
+	EfSearch int             `json:"ef_search,omitempty"`
+	Probes   int             `json:"probes,omitempty"`
+	// Lambda enables maximal marginal relevance ordering when set
+	Lambda *float64 `json:"lambda,omitempty"`
+	// Snippets returns the passages of each result that best match the query
+	Snippets      bool `json:"snippets,omitempty"`
+	SnippetLength int  `json:"snippet_length,omitempty"`
+	SnippetCount  int  `json:"snippet_count,omitempty"`
+	// OmitText leaves the matched text out of the results
+	OmitText bool `json:"omit_text,omitempty"`
 }
@@ -1,11 +1,38 @@
 package api
 
 type SimpleQueryResponseContent struct {
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	Text  string `json:"text"`
+	Dataset string `json:"dataset"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Text    string `json:"text,omitempty"`
+	// Snippets are only returned when requested
+	Snippets []Snippet      `json:"snippets,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// Score is the similarity to the query; higher is better. Its scale depends
+	// on the search mode and the dataset's distance metric.
+	Score float64 `json:"score"`
+}
+
+// Snippet is a passage of the matched text. Offsets count characters.
+type Snippet struct {
+	// Offset is the position of the passage in the matched text
+	Offset int    `json:"offset"`
+	Text   string `json:"text"`
+	// Highlights are the query term matches in Text
+	Highlights []Highlight `json:"highlights"`
+	// Fragment is Text as HTML with the matches wrapped in <mark> tags
+	Fragment string `json:"fragment"`
+}
+
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 type SimpleQueryResponse struct {
 	Responses []SimpleQueryResponseContent `json:"responses"`
+	// NextCursor fetches the next page when passed as cursor; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// TotalCandidates is an upper bound on the number of matching documents
+	TotalCandidates int `json:"total_candidates"`
 }
@@ -0,0 +1,34 @@
+package api
+
+import "time"
+
+type SessionResponse struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Model     string    `json:"model,omitempty"`
+	TurnCount int       `json:"turn_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Messages are only returned for a single session
+	Messages []MessageResponse `json:"messages,omitempty"`
+}
+
+type MessageResponse struct {
+	Role string `json:"role"`
+	// Content has its citations resolved into markdown links
+	Content string `json:"content"`
+	// Sources are the documents an answer was based on that still exist
+	Sources   []SourceResponse `json:"sources,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type SourceResponse struct {
+	ID      int64  `json:"id"`
+	Dataset string `json:"dataset"`
+	Title   string `json:"title"`
+	URL     string `json:"url,omitempty"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
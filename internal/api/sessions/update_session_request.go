@@ -0,0 +1,6 @@
+package api
+
+// UpdateSessionRequest changes only the fields that are present.
+type UpdateSessionRequest struct {
+	Title *string `json:"title,omitempty"`
+}
@@ -20,12 +20,33 @@ func NewAccessTokenAuthorizer(db *db.PostgresDB) *AccessTokenAuthorizer {
 }
 
 func (a *AccessTokenAuthorizer) CheckToken(accessTokenValue string) (bool, int64, error) {
+	token, err := a.findToken(accessTokenValue)
+	if err != nil || token == nil {
+		return false, 0, err
+	}
+
+	return true, token.UserID, nil
+}
+
+// CheckAdminToken is like CheckToken, but only accepts tokens of admin users.
+func (a *AccessTokenAuthorizer) CheckAdminToken(accessTokenValue string) (bool, int64, error) {
+	token, err := a.findToken(accessTokenValue)
+	if err != nil || token == nil || !token.Admin {
+		return false, 0, err
+	}
+
+	return true, token.UserID, nil
+}
+
+// findToken returns the access token with the given value, or nil when there
+// is none.
+func (a *AccessTokenAuthorizer) findToken(accessTokenValue string) (*models.AccessToken, error) {
 	if a.accessTokens == nil {
 		db := *a.DB
 
 		accessTokens, err := db.GetAccessTokens()
 		if err != nil {
-			return false, 0, fmt.Errorf("could not fetch access tokens %w", err)
+			return nil, fmt.Errorf("could not fetch access tokens %w", err)
 		}
 
 		a.accessTokens = accessTokens
@@ -33,11 +54,9 @@ func (a *AccessTokenAuthorizer) CheckToken(accessTokenValue string) (bool, int64
 
 	for _, token := range *a.accessTokens {
 		if token.Token == accessTokenValue {
-			return true, token.UserID, nil
+			return &token, nil
 		}
-
-		fmt.Printf("%s and %s are not equal", token.Token, accessTokenValue)
 	}
 
-	return false, 0, nil
+	return nil, nil
 }
@@ -0,0 +1,147 @@
+package chunking
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSize    = 200
+	DefaultOverlap = 40
+)
+
+// Chunker splits document bodies into overlapping chunks. Chunks are built
+// from whole sentences wherever possible so that an embedding never starts or
+// ends in the middle of a thought.
+type Chunker struct {
+	// Size is the maximum number of words in a chunk.
+	Size int
+	// Overlap is the number of words from the end of a chunk that are
+	// repeated at the start of the next one.
+	Overlap int
+}
+
+// NewChunker creates a Chunker, falling back to the defaults for invalid values.
+func NewChunker(size int, overlap int) *Chunker {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = min(DefaultOverlap, size/2)
+	}
+
+	return &Chunker{
+		Size:    size,
+		Overlap: overlap,
+	}
+}
+
+type sentence struct {
+	text  string
+	words int
+}
+
+// Split breaks text into chunks of at most Size words.
+func (c *Chunker) Split(text string) []string {
+	var units []sentence
+	for _, s := range splitSentences(text) {
+		words := strings.Fields(s)
+
+		// Sentences longer than a whole chunk are cut on word boundaries
+		for len(words) > c.Size {
+			units = append(units, sentence{text: strings.Join(words[:c.Size], " "), words: c.Size})
+			words = words[c.Size:]
+		}
+		if len(words) > 0 {
+			units = append(units, sentence{text: strings.Join(words, " "), words: len(words)})
+		}
+	}
+
+	var chunks []string
+	var current []sentence
+	count := 0
+
+	for _, unit := range units {
+		if count+unit.words > c.Size && count > 0 {
+			chunks = append(chunks, joinSentences(current))
+			current, count = c.overlapTail(current)
+
+			// Drop overlap from the front until the next sentence fits
+			for len(current) > 0 && count+unit.words > c.Size {
+				count -= current[0].words
+				current = current[1:]
+			}
+		}
+
+		current = append(current, unit)
+		count += unit.words
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, joinSentences(current))
+	}
+
+	return chunks
+}
+
+// overlapTail returns the trailing sentences of a chunk that fit in the overlap window.
+func (c *Chunker) overlapTail(current []sentence) ([]sentence, int) {
+	count := 0
+	start := len(current)
+	for start > 0 && count+current[start-1].words <= c.Overlap {
+		start--
+		count += current[start].words
+	}
+
+	tail := make([]sentence, len(current)-start)
+	copy(tail, current[start:])
+	return tail, count
+}
+
+func joinSentences(sentences []sentence) string {
+	parts := make([]string, len(sentences))
+	for i, s := range sentences {
+		parts[i] = s.text
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitSentences breaks text on sentence-ending punctuation and paragraph breaks.
+func splitSentences(text string) []string {
+	runes := []rune(text)
+
+	var sentences []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		end := -1
+
+		switch r := runes[i]; {
+		case r == '.' || r == '!' || r == '?':
+			j := i + 1
+			for j < len(runes) && strings.ContainsRune(`"')]”’`, runes[j]) {
+				j++
+			}
+			if j == len(runes) || unicode.IsSpace(runes[j]) {
+				end = j
+			}
+		case r == '\n' && i+1 < len(runes) && runes[i+1] == '\n':
+			end = i + 2
+		}
+
+		if end < 0 {
+			continue
+		}
+
+		if s := strings.TrimSpace(string(runes[start:end])); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = end
+		i = end - 1
+	}
+
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		sentences = append(sentences, s)
+	}
+
+	return sentences
+}
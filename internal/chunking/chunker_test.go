@@ -0,0 +1,101 @@
+package chunking
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkerSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		text    string
+		want    []string
+	}{
+		{
+			name: "empty",
+			size: 10,
+			text: "  \n\n ",
+			want: nil,
+		},
+		{
+			name: "fits one chunk",
+			size: 10,
+			text: "One two three. Four five.",
+			want: []string{"One two three. Four five."},
+		},
+		{
+			name: "splits on sentences",
+			size: 5,
+			text: "One two three. Four five six. Seven.",
+			want: []string{"One two three.", "Four five six. Seven."},
+		},
+		{
+			name:    "repeats overlap",
+			size:    5,
+			overlap: 3,
+			text:    "One two. Three four five. Six seven.",
+			want:    []string{"One two. Three four five.", "Three four five. Six seven."},
+		},
+		{
+			name:    "drops overlap that does not fit",
+			size:    5,
+			overlap: 3,
+			text:    "One two. Three four five. Six seven eight.",
+			want:    []string{"One two. Three four five.", "Six seven eight."},
+		},
+		{
+			name: "cuts long sentences on words",
+			size: 3,
+			text: "One two three four five six seven.",
+			want: []string{"One two three", "four five six", "seven."},
+		},
+		{
+			name: "splits on paragraphs",
+			size: 3,
+			text: "First paragraph here\n\nSecond one",
+			want: []string{"First paragraph here", "Second one"},
+		},
+		{
+			name: "keeps closing quotes",
+			size: 3,
+			text: `He said "stop." Then left.`,
+			want: []string{`He said "stop."`, "Then left."},
+		},
+		{
+			name: "ignores inner dots",
+			size: 10,
+			text: "Version 1.2 is out.",
+			want: []string{"Version 1.2 is out."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunker := &Chunker{Size: tt.size, Overlap: tt.overlap}
+			if got := chunker.Split(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewChunker(t *testing.T) {
+	tests := []struct {
+		size, overlap         int
+		wantSize, wantOverlap int
+	}{
+		{size: 100, overlap: 10, wantSize: 100, wantOverlap: 10},
+		{size: 0, overlap: 10, wantSize: DefaultSize, wantOverlap: 10},
+		{size: 100, overlap: -1, wantSize: 100, wantOverlap: DefaultOverlap},
+		{size: 20, overlap: 20, wantSize: 20, wantOverlap: 10},
+	}
+
+	for _, tt := range tests {
+		chunker := NewChunker(tt.size, tt.overlap)
+		if chunker.Size != tt.wantSize || chunker.Overlap != tt.wantOverlap {
+			t.Errorf("NewChunker(%d, %d) = %+v, want size %d and overlap %d", tt.size, tt.overlap, *chunker, tt.wantSize, tt.wantOverlap)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+func (pg *PostgresDB) GetOrCreateDataset(datasetName string, userId int64) (int64, error) {
+	if datasetName == "" {
+		return 0, errors.New("dataset name cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		WITH data as (
+			INSERT INTO datasets (name, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (name, user_id) DO NOTHING
+			RETURNING id
+		)
+		SELECT id FROM data
+			UNION ALL
+		SELECT id FROM datasets WHERE name=$1 AND user_id = $2
+		LIMIT 1;
+	`
+
+	var id int64
+	err := pg.db.QueryRowContext(ctx, query, datasetName, userId).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dataset id: %w", err)
+	}
+
+	return id, err
+}
+
+// Summarizes each dataset with its document count and the time it last changed
+const datasetSummaryQuery = `
+	SELECT
+		datasets.id,
+		datasets.name,
+		COALESCE(datasets.description, ''),
+		datasets.distance_metric,
+		datasets.vector_index_type,
+		datasets.hyde_mode,
+		COUNT(documents.id),
+		datasets.created_at,
+		GREATEST(datasets.created_at, MAX(documents.updated_at))
+	FROM datasets
+	LEFT JOIN documents ON documents.dataset_id = datasets.id
+`
+
+func (pg *PostgresDB) ListDatasets(userId int64) ([]models.Dataset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := datasetSummaryQuery + `
+		WHERE datasets.user_id = $1
+		GROUP BY datasets.id
+		ORDER BY datasets.name
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	datasets := []models.Dataset{}
+	for rows.Next() {
+		var dataset models.Dataset
+		err := rows.Scan(&dataset.ID, &dataset.Name, &dataset.Description, &dataset.DistanceMetric, &dataset.IndexType, &dataset.HyDEMode, &dataset.DocumentCount, &dataset.CreatedAt, &dataset.LastUpdated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dataset: %w", err)
+		}
+		datasets = append(datasets, dataset)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through datasets: %w", rows.Err())
+	}
+
+	return datasets, nil
+}
+
+func (pg *PostgresDB) GetDataset(datasetName string, userId int64) (*models.Dataset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := datasetSummaryQuery + `
+		WHERE datasets.name = $1 AND datasets.user_id = $2
+		GROUP BY datasets.id
+	`
+
+	var dataset models.Dataset
+	err := pg.db.QueryRowContext(ctx, query, datasetName, userId).
+		Scan(&dataset.ID, &dataset.Name, &dataset.Description, &dataset.DistanceMetric, &dataset.IndexType, &dataset.HyDEMode, &dataset.DocumentCount, &dataset.CreatedAt, &dataset.LastUpdated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve dataset: %w", err)
+	}
+
+	return &dataset, nil
+}
+
+// DefaultHyDEMode returns the HyDE mode shared by all of the named datasets.
+// The query is embedded once for every dataset, so HyDEOff is returned when
+// their modes differ, or when none of them exist.
+func (pg *PostgresDB) DefaultHyDEMode(datasetNames []string, userId int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(DISTINCT hyde_mode), COALESCE(MIN(hyde_mode), $2)
+		FROM datasets
+		WHERE user_id = $1
+			AND ($3 OR name = ANY($4))
+	`
+
+	var modes int
+	var mode string
+	err := pg.db.QueryRowContext(ctx, query, userId, HyDEOff, slices.Contains(datasetNames, AllDatasets), pq.Array(datasetNames)).Scan(&modes, &mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to get hyde mode: %w", err)
+	}
+	if modes != 1 {
+		return HyDEOff, nil
+	}
+
+	return mode, nil
+}
+
+// UpdateDataset renames a dataset and changes its description and vector
+// search settings. ErrConflict is returned when the new name is already taken.
+// Changing the distance metric or index type rebuilds the dataset's vector
+// index in the background; searches work without it in the meantime.
+func (pg *PostgresDB) UpdateDataset(datasetName string, userId int64, update models.DatasetUpdate) error {
+	if update.DistanceMetric != nil {
+		if err := ValidateDistanceMetric(*update.DistanceMetric); err != nil {
+			return err
+		}
+	}
+	if update.IndexType != nil {
+		if err := ValidateIndexType(*update.IndexType); err != nil {
+			return err
+		}
+	}
+	if update.HyDEMode != nil {
+		if err := ValidateHyDEMode(*update.HyDEMode); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE datasets
+		SET
+			name = COALESCE($3, name),
+			description = COALESCE($4, description),
+			distance_metric = COALESCE($5, distance_metric),
+			vector_index_type = COALESCE($6, vector_index_type),
+			hyde_mode = COALESCE($7, hyde_mode)
+		WHERE name = $1 AND user_id = $2
+		RETURNING id
+	`
+
+	var datasetId int64
+	err := pg.db.QueryRowContext(ctx, query, datasetName, userId, update.Name, update.Description, update.DistanceMetric, update.IndexType, update.HyDEMode).
+		Scan(&datasetId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return fmt.Errorf("failed to update dataset: %w", err)
+	}
+
+	if update.DistanceMetric != nil || update.IndexType != nil {
+		pg.queueVectorIndexRebuild(datasetId)
+	}
+
+	return nil
+}
+
+// DeleteDataset removes a dataset and its vector index. Its documents and
+// chunks are removed by the cascading foreign keys, and the index is dropped
+// once they are gone.
+func (pg *PostgresDB) DeleteDataset(datasetName string, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM datasets
+		WHERE name = $1 AND user_id = $2
+		RETURNING id
+	`
+
+	var datasetId int64
+	err := pg.db.QueryRowContext(ctx, query, datasetName, userId).Scan(&datasetId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete dataset: %w", err)
+	}
+
+	pg.dropVectorIndexes(datasetId)
+
+	return nil
+}
@@ -0,0 +1,428 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/pgvector/pgvector-go"
+)
+
+// AddDocument inserts a document and its chunks. ErrConflict is returned when
+// the dataset already holds a document with the same external ID or content.
+func (pg *PostgresDB) AddDocument(doc models.Document, chunks []models.Chunk) (int64, error) {
+	if err := validateChunks(chunks); err != nil {
+		return 0, err
+	}
+
+	metadata, err := encodeMetadata(doc.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO documents (dataset_id, external_id, title, url, body, metadata, content_hash)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`
+
+	var insertedID int64
+	err = tx.QueryRowContext(ctx, query, doc.DatasetID, doc.ExternalID, doc.Title, doc.URL, doc.Body, metadata, doc.ContentHash).Scan(&insertedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrConflict
+		}
+		return 0, fmt.Errorf("failed to insert document: %w", err)
+	}
+
+	if err := insertChunks(ctx, tx, insertedID, chunks); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit document: %w", err)
+	}
+
+	if len(chunks) > 0 {
+		pg.ensureVectorIndex(doc.DatasetID, len(chunks[0].Vec))
+	}
+
+	return insertedID, nil
+}
+
+// ReplaceDocument overwrites the content of one of the user's documents and
+// swaps its chunks for new ones. ErrNotFound is returned when the user has no
+// such document, and ErrConflict when another document in the dataset already
+// has the new content.
+func (pg *PostgresDB) ReplaceDocument(doc models.Document, userId int64, chunks []models.Chunk) error {
+	if err := validateChunks(chunks); err != nil {
+		return err
+	}
+
+	metadata, err := encodeMetadata(doc.Metadata)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE documents
+		SET title = $2, url = $3, body = $4, metadata = $5, content_hash = $6, updated_at = now()
+		FROM datasets
+		WHERE documents.id = $1
+			AND datasets.id = documents.dataset_id
+			AND datasets.user_id = $7
+		RETURNING documents.dataset_id
+	`
+
+	var datasetId int64
+	err = tx.QueryRowContext(ctx, query, doc.ID, doc.Title, doc.URL, doc.Body, metadata, doc.ContentHash, userId).Scan(&datasetId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chunks WHERE document_id = $1`, doc.ID); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+
+	if err := insertChunks(ctx, tx, doc.ID, chunks); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit document: %w", err)
+	}
+
+	if len(chunks) > 0 {
+		pg.ensureVectorIndex(datasetId, len(chunks[0].Vec))
+	}
+
+	return nil
+}
+
+// UpdateDocumentDetails changes the title, URL and metadata of one of the
+// user's documents without touching its content or embeddings. ErrNotFound is
+// returned when the user has no such document.
+func (pg *PostgresDB) UpdateDocumentDetails(doc models.Document, userId int64) error {
+	metadata, err := encodeMetadata(doc.Metadata)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE documents
+		SET title = $2, url = $3, metadata = $4, updated_at = now()
+		FROM datasets
+		WHERE documents.id = $1
+			AND datasets.id = documents.dataset_id
+			AND datasets.user_id = $5
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, doc.ID, doc.Title, doc.URL, metadata, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// FindDocument looks up the document in a dataset that a new upload would
+// duplicate: the one with the same external ID when one is given, otherwise the
+// one with the same content, whatever its external ID.
+func (pg *PostgresDB) FindDocument(datasetId int64, externalId string, contentHash string) (*models.Document, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, dataset_id, COALESCE(external_id, ''), title, url, metadata, content_hash
+		FROM documents
+		WHERE dataset_id = $1 AND external_id = $2
+	`
+
+	var doc models.Document
+	var metadata []byte
+	err := pg.db.QueryRowContext(ctx, query, datasetId, externalId).
+		Scan(&doc.ID, &doc.DatasetID, &doc.ExternalID, &doc.Title, &doc.URL, &metadata, &doc.ContentHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		query = `
+			SELECT id, dataset_id, COALESCE(external_id, ''), title, url, metadata, content_hash
+			FROM documents
+			WHERE dataset_id = $1 AND content_hash = $2
+		`
+
+		err = pg.db.QueryRowContext(ctx, query, datasetId, contentHash).
+			Scan(&doc.ID, &doc.DatasetID, &doc.ExternalID, &doc.Title, &doc.URL, &metadata, &doc.ContentHash)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find document: %w", err)
+	}
+
+	if doc.Metadata, err = decodeMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+func validateChunks(chunks []models.Chunk) error {
+	if len(chunks) == 0 {
+		return errors.New("document must have at least one chunk")
+	}
+	for _, chunk := range chunks {
+		if len(chunk.Vec) == 0 {
+			return errors.New("vector cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+func insertChunks(ctx context.Context, tx *sql.Tx, documentId int64, chunks []models.Chunk) error {
+	// Chunks carry their document's dataset so each dataset can have its own vector index
+	query := `
+		INSERT INTO chunks (document_id, dataset_id, chunk_index, body, token_count, vector)
+		SELECT $1, dataset_id, $2, $3, $4, $5
+		FROM documents
+		WHERE id = $1
+	`
+
+	for i, chunk := range chunks {
+		// Use pgvector-go to create a Vector type
+		vec := pgvector.NewVector(chunk.Vec)
+
+		if _, err := tx.ExecContext(ctx, query, documentId, i, chunk.Body, chunk.TokenCount, vec); err != nil {
+			return fmt.Errorf("failed to insert chunk %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// GetDocument returns a document with its full body if it belongs to one of the user's datasets.
+func (pg *PostgresDB) GetDocument(id int64, userId int64) (*models.Document, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			documents.id,
+			documents.dataset_id,
+			datasets.name,
+			COALESCE(documents.external_id, ''),
+			documents.title,
+			COALESCE(documents.url, ''),
+			documents.body,
+			documents.metadata,
+			documents.content_hash,
+			documents.created_at,
+			documents.updated_at
+		FROM documents
+		JOIN datasets ON datasets.id = documents.dataset_id
+		WHERE documents.id = $1 AND datasets.user_id = $2
+	`
+
+	var doc models.Document
+	var metadata []byte
+	err := pg.db.QueryRowContext(ctx, query, id, userId).Scan(
+		&doc.ID, &doc.DatasetID, &doc.Dataset, &doc.ExternalID, &doc.Title, &doc.URL,
+		&doc.Body, &metadata, &doc.ContentHash, &doc.CreatedAt, &doc.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve document: %w", err)
+	}
+
+	if doc.Metadata, err = decodeMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// ListDocuments returns a page of the user's documents, newest first, without
+// their bodies. An empty datasetName lists documents across all datasets.
+func (pg *PostgresDB) ListDocuments(userId int64, datasetName string, limit int, offset int) ([]models.Document, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be greater than zero")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			documents.id,
+			documents.dataset_id,
+			datasets.name,
+			COALESCE(documents.external_id, ''),
+			documents.title,
+			COALESCE(documents.url, ''),
+			documents.metadata,
+			documents.created_at,
+			documents.updated_at
+		FROM documents
+		JOIN datasets ON datasets.id = documents.dataset_id
+		WHERE datasets.user_id = $1 AND ($2 = '' OR datasets.name = $2)
+		ORDER BY documents.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userId, datasetName, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		var doc models.Document
+		var metadata []byte
+		err := rows.Scan(
+			&doc.ID, &doc.DatasetID, &doc.Dataset, &doc.ExternalID, &doc.Title, &doc.URL,
+			&metadata, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		if doc.Metadata, err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through documents: %w", rows.Err())
+	}
+
+	return documents, nil
+}
+
+// GetDocumentsByID returns the user's documents with the given IDs, without
+// their bodies. Documents that no longer exist are left out.
+func (pg *PostgresDB) GetDocumentsByID(ids []int64, userId int64) ([]models.Document, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			documents.id,
+			documents.dataset_id,
+			datasets.name,
+			COALESCE(documents.external_id, ''),
+			documents.title,
+			COALESCE(documents.url, ''),
+			documents.metadata,
+			documents.created_at,
+			documents.updated_at
+		FROM documents
+		JOIN datasets ON datasets.id = documents.dataset_id
+		WHERE documents.id = ANY($1) AND datasets.user_id = $2
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, pq.Array(ids), userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		var doc models.Document
+		var metadata []byte
+		err := rows.Scan(
+			&doc.ID, &doc.DatasetID, &doc.Dataset, &doc.ExternalID, &doc.Title, &doc.URL,
+			&metadata, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		if doc.Metadata, err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through documents: %w", rows.Err())
+	}
+
+	return documents, nil
+}
+
+// DeleteDocument removes a document and its chunks if it belongs to one of the user's datasets.
+func (pg *PostgresDB) DeleteDocument(id int64, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM documents
+		USING datasets
+		WHERE documents.id = $1
+			AND datasets.id = documents.dataset_id
+			AND datasets.user_id = $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
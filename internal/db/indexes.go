@@ -0,0 +1,441 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+// Distance metrics a dataset can rank its chunks by
+const (
+	DistanceL2           = "l2"
+	DistanceCosine       = "cosine"
+	DistanceInnerProduct = "inner_product"
+)
+
+// Vector index types a dataset can use
+const (
+	IndexHNSW    = "hnsw"
+	IndexIVFFlat = "ivfflat"
+	IndexNone    = "none"
+)
+
+// Vector index statuses reported by VectorIndexes
+const (
+	IndexStatusReady       = "ready"
+	IndexStatusMissing     = "missing"
+	IndexStatusInvalid     = "invalid"
+	IndexStatusDisabled    = "disabled"
+	IndexStatusPending     = "pending"
+	IndexStatusUnindexable = "unindexable"
+	IndexStatusRebuilding  = "rebuilding"
+)
+
+// rebuildTimeout bounds how long building a vector index may take
+const rebuildTimeout = 30 * time.Minute
+
+// indexLockSpace is the first key of the advisory locks held while a dataset's
+// vector index is rebuilt; the second is the dataset ID
+const indexLockSpace = 1
+
+// maxIndexDimensions is the largest vector pgvector can index. Datasets with
+// larger embeddings are searched without an index.
+const maxIndexDimensions = 2000
+
+type distanceMetric struct {
+	// operator is the pgvector distance operator
+	operator string
+	// opclass is the index operator class matching the operator
+	opclass string
+	// score turns a distance into a similarity from 0 to 1 where higher is
+	// better, so datasets with different metrics can be ranked and filtered
+	// together
+	score string
+}
+
+var distanceMetrics = map[string]distanceMetric{
+	DistanceL2:     {operator: "<->", opclass: "vector_l2_ops", score: "1 / (1 + %s)"},
+	DistanceCosine: {operator: "<=>", opclass: "vector_cosine_ops", score: "1 - %s / 2"},
+	// The logistic function of the inner product, clamped so exp cannot overflow
+	DistanceInnerProduct: {operator: "<#>", opclass: "vector_ip_ops", score: "1 / (1 + exp(GREATEST(LEAST(%s, 700), -700)))"},
+}
+
+// ValidateDistanceMetric reports whether metric is a supported distance metric.
+func ValidateDistanceMetric(metric string) error {
+	if _, ok := distanceMetrics[metric]; !ok {
+		return fmt.Errorf("unknown distance metric: %s", metric)
+	}
+	return nil
+}
+
+// ValidateIndexType reports whether indexType is a supported vector index type.
+func ValidateIndexType(indexType string) error {
+	switch indexType {
+	case IndexHNSW, IndexIVFFlat, IndexNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown index type: %s", indexType)
+	}
+}
+
+// vectorIndexName is the name of the partial index over a dataset's chunks.
+func vectorIndexName(datasetId int64) string {
+	return fmt.Sprintf("chunks_vector_dataset_%d_idx", datasetId)
+}
+
+// buildIndexName is the name a dataset's vector index is built under before it
+// replaces the current one.
+func buildIndexName(datasetId int64) string {
+	return fmt.Sprintf("chunks_vector_dataset_%d_build_idx", datasetId)
+}
+
+// vectorExpression is the expression a dataset's chunks are indexed and
+// searched by. pgvector can only index vectors of a fixed size, so the column
+// is cast to the dataset's dimensions once they are known.
+func vectorExpression(dimensions sql.NullInt64) string {
+	if !dimensions.Valid {
+		return "chunks.vector"
+	}
+	return fmt.Sprintf("(chunks.vector::vector(%d))", dimensions.Int64)
+}
+
+// ensureVectorIndex records the embedding dimensions of a dataset the first
+// time chunks are stored in it and starts building the dataset's HNSW index in
+// the background. IVFFlat indexes are not created here since they need the
+// dataset's data to cluster well; build them with RebuildVectorIndex once the
+// data is loaded. Failures are logged rather than returned since the chunks are
+// already stored and searching works without the index.
+func (pg *PostgresDB) ensureVectorIndex(datasetId int64, dimensions int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Only the first writer sees the dimensions unset, so the index is built once
+	query := `
+		UPDATE datasets
+		SET vector_dimensions = $2
+		WHERE id = $1 AND vector_dimensions IS NULL
+		RETURNING vector_index_type
+	`
+
+	var indexType string
+	err := pg.db.QueryRowContext(ctx, query, datasetId, dimensions).Scan(&indexType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create vector index for dataset %d: %v", datasetId, err)
+		return
+	}
+
+	if indexType == IndexHNSW {
+		pg.queueVectorIndexRebuild(datasetId)
+	}
+}
+
+// RebuildVectorIndex replaces the vector index of a dataset with one for its
+// current distance metric and index type, waiting for any rebuild of the
+// dataset that is already running. See StartVectorIndexRebuild.
+func (pg *PostgresDB) RebuildVectorIndex(datasetId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	conn, err := pg.lockVectorIndex(ctx, datasetId, true)
+	if err != nil {
+		return err
+	}
+	defer unlockVectorIndex(conn, datasetId)
+
+	return buildVectorIndex(ctx, conn, datasetId)
+}
+
+// StartVectorIndexRebuild replaces the vector index of a dataset in the
+// background, logging failures. ErrConflict is returned when the dataset's
+// index is already being rebuilt. The new index is built next to the old one
+// without locking the chunks table, so searches and ingestion carry on while
+// it builds, and then takes its place.
+func (pg *PostgresDB) StartVectorIndexRebuild(datasetId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+
+	conn, err := pg.lockVectorIndex(ctx, datasetId, false)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	go func() {
+		defer cancel()
+		defer unlockVectorIndex(conn, datasetId)
+
+		if err := buildVectorIndex(ctx, conn, datasetId); err != nil {
+			log.Printf("Failed to rebuild vector index for dataset %d: %v", datasetId, err)
+		}
+	}()
+
+	return nil
+}
+
+// queueVectorIndexRebuild replaces the vector index of a dataset in the
+// background once any rebuild of it that is already running is done, logging
+// failures.
+func (pg *PostgresDB) queueVectorIndexRebuild(datasetId int64) {
+	go func() {
+		if err := pg.RebuildVectorIndex(datasetId); err != nil {
+			log.Printf("Failed to rebuild vector index for dataset %d: %v", datasetId, err)
+		}
+	}()
+}
+
+// dropVectorIndexes removes the vector index of a deleted dataset, along with
+// any index left over from an unfinished build. Failures are logged since the
+// dataset is already gone.
+func (pg *PostgresDB) dropVectorIndexes(datasetId int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	for _, name := range []string{vectorIndexName(datasetId), buildIndexName(datasetId)} {
+		if _, err := pg.db.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+name); err != nil {
+			log.Printf("Failed to drop vector index %s: %v", name, err)
+		}
+	}
+}
+
+// lockVectorIndex takes the advisory lock that keeps rebuilds of a dataset's
+// index from overlapping, on a connection of its own since the lock belongs to
+// the connection. Without wait, ErrConflict is returned when the lock is held.
+func (pg *PostgresDB) lockVectorIndex(ctx context.Context, datasetId int64, wait bool) (*sql.Conn, error) {
+	conn, err := pg.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	locked := true
+	if wait {
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, $2)`, indexLockSpace, datasetId)
+	} else {
+		err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, $2)`, indexLockSpace, datasetId).Scan(&locked)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock vector index: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrConflict
+	}
+
+	return conn, nil
+}
+
+// unlockVectorIndex releases the lock taken by lockVectorIndex and returns the
+// connection to the pool. A connection that may still hold the lock is
+// discarded instead.
+func unlockVectorIndex(conn *sql.Conn, datasetId int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1, $2)`, indexLockSpace, datasetId); err != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
+
+// buildVectorIndex builds a dataset's new vector index under a temporary name
+// and swaps it in for the old one. Every statement runs on its own, since
+// indexes cannot be built or dropped concurrently inside a transaction.
+// Datasets created before their dimensions were recorded get them filled in
+// from their chunks.
+func buildVectorIndex(ctx context.Context, conn *sql.Conn, datasetId int64) error {
+	query := `
+		SELECT distance_metric, vector_index_type, vector_dimensions
+		FROM datasets
+		WHERE id = $1
+	`
+
+	var metric, indexType string
+	var dimensions sql.NullInt64
+	err := conn.QueryRowContext(ctx, query, datasetId).Scan(&metric, &indexType, &dimensions)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to retrieve dataset: %w", err)
+	}
+
+	if !dimensions.Valid {
+		query := `
+			UPDATE datasets
+			SET vector_dimensions = (SELECT vector_dims(vector) FROM chunks WHERE dataset_id = $1 LIMIT 1)
+			WHERE id = $1
+			RETURNING vector_dimensions
+		`
+		if err := conn.QueryRowContext(ctx, query, datasetId).Scan(&dimensions); err != nil {
+			return fmt.Errorf("failed to record vector dimensions: %w", err)
+		}
+	}
+
+	name := vectorIndexName(datasetId)
+	buildName := buildIndexName(datasetId)
+
+	// An interrupted build leaves an invalid index behind
+	if _, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+buildName); err != nil {
+		return fmt.Errorf("failed to drop unfinished vector index: %w", err)
+	}
+
+	if indexType == IndexNone || !dimensions.Valid || dimensions.Int64 > maxIndexDimensions {
+		if _, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+name); err != nil {
+			return fmt.Errorf("failed to drop vector index: %w", err)
+		}
+		return nil
+	}
+
+	options, err := vectorIndexOptions(ctx, conn, datasetId, indexType)
+	if err != nil {
+		return err
+	}
+
+	// Identifiers and the predicate cannot be parameters; all values are integers
+	// or come from the constants above
+	query = fmt.Sprintf(
+		`CREATE INDEX CONCURRENTLY %s ON chunks USING %s (%s %s)%s WHERE dataset_id = %d`,
+		buildName, indexType, vectorExpression(dimensions), distanceMetrics[metric].opclass, options, datasetId,
+	)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create vector index: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+name); err != nil {
+		return fmt.Errorf("failed to drop old vector index: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`ALTER INDEX %s RENAME TO %s`, buildName, name)); err != nil {
+		return fmt.Errorf("failed to rename vector index: %w", err)
+	}
+
+	return nil
+}
+
+// DatasetIDs returns the IDs of every dataset of every user.
+func (pg *PostgresDB) DatasetIDs() ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, `SELECT id FROM datasets ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan dataset: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through datasets: %w", rows.Err())
+	}
+
+	return ids, nil
+}
+
+// VectorIndexes reports the state of the vector index of each of the user's datasets.
+func (pg *PostgresDB) VectorIndexes(userId int64) ([]models.VectorIndex, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			datasets.id,
+			datasets.name,
+			datasets.distance_metric,
+			datasets.vector_index_type,
+			datasets.vector_dimensions,
+			(SELECT COUNT(*) FROM chunks WHERE chunks.dataset_id = datasets.id),
+			pg_index.indisvalid,
+			COALESCE(pg_relation_size(pg_class.oid), 0),
+			EXISTS (
+				SELECT 1 FROM pg_locks
+				WHERE locktype = 'advisory' AND granted
+					AND classid::int8 = $2 AND objid::int8 = datasets.id AND objsubid = 2
+			)
+		FROM datasets
+		LEFT JOIN pg_class ON pg_class.relname = 'chunks_vector_dataset_' || datasets.id || '_idx'
+		LEFT JOIN pg_index ON pg_index.indexrelid = pg_class.oid
+		WHERE datasets.user_id = $1
+		ORDER BY datasets.name
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userId, indexLockSpace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	indexes := []models.VectorIndex{}
+	for rows.Next() {
+		var index models.VectorIndex
+		var datasetId int64
+		var dimensions sql.NullInt64
+		var valid sql.NullBool
+		var rebuilding bool
+		err := rows.Scan(&datasetId, &index.Dataset, &index.Metric, &index.Type, &dimensions, &index.Chunks, &valid, &index.SizeBytes, &rebuilding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan vector index: %w", err)
+		}
+
+		index.Name = vectorIndexName(datasetId)
+		index.Dimensions = int(dimensions.Int64)
+
+		switch {
+		case rebuilding:
+			index.Status = IndexStatusRebuilding
+		case index.Type == IndexNone:
+			index.Status = IndexStatusDisabled
+		case !dimensions.Valid:
+			index.Status = IndexStatusPending
+		case dimensions.Int64 > maxIndexDimensions:
+			index.Status = IndexStatusUnindexable
+		case !valid.Valid:
+			index.Status = IndexStatusMissing
+		case !valid.Bool:
+			index.Status = IndexStatusInvalid
+		default:
+			index.Status = IndexStatusReady
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through vector indexes: %w", rows.Err())
+	}
+
+	return indexes, nil
+}
+
+// rowQuerier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// vectorIndexOptions returns the WITH clause for a dataset's vector index.
+func vectorIndexOptions(ctx context.Context, db rowQuerier, datasetId int64, indexType string) (string, error) {
+	if indexType != IndexIVFFlat {
+		return "", nil
+	}
+
+	// pgvector recommends a list per thousand rows, with a floor for small datasets
+	var rows int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM chunks WHERE dataset_id = $1`, datasetId).Scan(&rows); err != nil {
+		return "", fmt.Errorf("failed to count chunks: %w", err)
+	}
+	return fmt.Sprintf(" WITH (lists = %d)", max(rows/1000, 10)), nil
+}
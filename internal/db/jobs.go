@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+
+	jobItemStatusPending    = "pending"
+	jobItemStatusProcessing = "processing"
+	jobItemStatusDone       = "done"
+	jobItemStatusFailed     = "failed"
+)
+
+// CreateIngestionJob stores a job along with one pending item per JSON payload.
+func (pg *PostgresDB) CreateIngestionJob(id string, userId int64, payloads [][]byte) error {
+	if id == "" {
+		return errors.New("job ID cannot be empty")
+	}
+	if len(payloads) == 0 {
+		return errors.New("job must have at least one item")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO ingestion_jobs (id, user_id)
+		VALUES ($1, $2)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, id, userId); err != nil {
+		return fmt.Errorf("failed to insert job: %w", err)
+	}
+
+	items := make([]string, len(payloads))
+	for i, payload := range payloads {
+		items[i] = string(payload)
+	}
+
+	query = `
+		INSERT INTO ingestion_job_items (job_id, item_index, payload)
+		SELECT $1, item.ordinality - 1, item.payload::jsonb
+		FROM unnest($2::text[]) WITH ORDINALITY AS item(payload, ordinality)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, id, pq.Array(items)); err != nil {
+		return fmt.Errorf("failed to insert job items: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit job: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimIngestionJobItems marks up to limit pending items as processing and
+// returns them, oldest job first and in order within each job. Items locked by
+// another worker are skipped, so workers never wait on each other. The claim is a
+// lease: items still processing once it has expired were abandoned, for example
+// by a server that stopped, and are claimed again. Requeued items wait until
+// their retry time. An empty slice is returned when there is no work left.
+func (pg *PostgresDB) ClaimIngestionJobItems(limit int, lease time.Duration) ([]models.IngestionJobItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Items claimed before leases were recorded have no claimed_at
+	query := `
+		WITH next_items AS (
+			SELECT items.job_id, items.item_index
+			FROM ingestion_job_items items
+			JOIN ingestion_jobs jobs ON jobs.id = items.job_id
+			WHERE (items.status = $1 AND (items.retry_at IS NULL OR items.retry_at <= now()))
+				OR (items.status = $2
+					AND (items.claimed_at IS NULL OR items.claimed_at < now() - make_interval(secs => $4)))
+			ORDER BY jobs.created_at, items.job_id, items.item_index
+			LIMIT $3
+			FOR UPDATE OF items SKIP LOCKED
+		), claimed AS (
+			UPDATE ingestion_job_items items
+			SET status = $2, claimed_at = now(), attempts = items.attempts + 1, retry_at = NULL
+			FROM next_items, ingestion_jobs jobs
+			WHERE items.job_id = next_items.job_id
+				AND items.item_index = next_items.item_index
+				AND jobs.id = items.job_id
+			RETURNING items.job_id, jobs.user_id, items.item_index, items.payload, items.claimed_at, items.attempts, jobs.created_at
+		)
+		SELECT job_id, user_id, item_index, payload, claimed_at, attempts
+		FROM claimed
+		ORDER BY created_at, job_id, item_index
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, jobItemStatusPending, jobItemStatusProcessing, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.IngestionJobItem
+	for rows.Next() {
+		var item models.IngestionJobItem
+		if err := rows.Scan(&item.JobID, &item.UserID, &item.Index, &item.Payload, &item.ClaimedAt, &item.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan job item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through job items: %w", rows.Err())
+	}
+
+	return items, nil
+}
+
+// FinishIngestionJobItem records the outcome of a claimed item. An empty
+// errorMessage marks the item as done. ErrNotFound is returned, and nothing is
+// recorded, when the claim has since expired and the item was claimed again.
+func (pg *PostgresDB) FinishIngestionJobItem(item models.IngestionJobItem, documentId int64, errorMessage string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status := jobItemStatusDone
+	var docId, message any = documentId, nil
+	if errorMessage != "" {
+		status = jobItemStatusFailed
+		docId, message = nil, errorMessage
+	}
+
+	query := `
+		UPDATE ingestion_job_items
+		SET status = $3, document_id = $4, error = $5
+		WHERE job_id = $1 AND item_index = $2 AND status = $6 AND claimed_at = $7
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, item.JobID, item.Index, status, docId, message, jobItemStatusProcessing, item.ClaimedAt)
+	if err != nil {
+		return fmt.Errorf("failed to finish job item: %w", err)
+	}
+
+	return checkClaimed(result)
+}
+
+// RequeueIngestionJobItem puts a claimed item back in the queue to be tried
+// again once delay has passed, keeping errorMessage as its last error.
+// ErrNotFound is returned, and nothing is changed, when the claim has since
+// expired and the item was claimed again.
+func (pg *PostgresDB) RequeueIngestionJobItem(item models.IngestionJobItem, delay time.Duration, errorMessage string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE ingestion_job_items
+		SET status = $3, error = $4, claimed_at = NULL, retry_at = now() + make_interval(secs => $5)
+		WHERE job_id = $1 AND item_index = $2 AND status = $6 AND claimed_at = $7
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, item.JobID, item.Index, jobItemStatusPending, errorMessage, delay.Seconds(), jobItemStatusProcessing, item.ClaimedAt)
+	if err != nil {
+		return fmt.Errorf("failed to requeue job item: %w", err)
+	}
+
+	return checkClaimed(result)
+}
+
+// checkClaimed returns ErrNotFound when an update of a claimed item matched no
+// rows because the claim was lost.
+func checkClaimed(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update job item: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (pg *PostgresDB) GetIngestionJob(id string, userId int64) (*models.IngestionJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			jobs.id,
+			jobs.created_at,
+			COUNT(items.item_index),
+			COUNT(items.item_index) FILTER (WHERE items.status IN ($3, $4)),
+			COUNT(items.item_index) FILTER (WHERE items.status = $4)
+		FROM ingestion_jobs jobs
+		JOIN ingestion_job_items items ON items.job_id = jobs.id
+		WHERE jobs.id = $1 AND jobs.user_id = $2
+		GROUP BY jobs.id
+	`
+
+	var job models.IngestionJob
+	err := pg.db.QueryRowContext(ctx, query, id, userId, jobItemStatusDone, jobItemStatusFailed).
+		Scan(&job.ID, &job.CreatedAt, &job.Total, &job.Processed, &job.Failed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve job: %w", err)
+	}
+
+	switch {
+	case job.Processed == job.Total:
+		job.Status = JobStatusCompleted
+	case job.Processed > 0:
+		job.Status = JobStatusRunning
+	default:
+		job.Status = JobStatusPending
+	}
+
+	query = `
+		SELECT item_index, error
+		FROM ingestion_job_items
+		WHERE job_id = $1 AND status = $2
+		ORDER BY item_index
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, id, jobItemStatusFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	job.Errors = []models.IngestionJobError{}
+	for rows.Next() {
+		var jobError models.IngestionJobError
+		if err := rows.Scan(&jobError.Index, &jobError.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan job error: %w", err)
+		}
+		job.Errors = append(job.Errors, jobError)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through job errors: %w", rows.Err())
+	}
+
+	return &job, nil
+}
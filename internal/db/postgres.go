@@ -8,9 +8,14 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/lib/pq"
 	"github.com/mrhollen/KnowledgeGPT/internal/models"
-	"github.com/pgvector/pgvector-go"
+)
+
+var (
+	// ErrNotFound is returned when a requested row does not exist or belongs to another user
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness constraint
+	ErrConflict = errors.New("conflict")
 )
 
 type PostgresDB struct {
@@ -37,232 +42,15 @@ func NewPostgresDB(connString string) (*PostgresDB, error) {
 	return &PostgresDB{db: db}, nil
 }
 
-func (pg *PostgresDB) AddDocument(doc models.Document) error {
-	if len(doc.Vec) == 0 {
-		return errors.New("vector cannot be empty")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Use pgvector-go to create a Vector type
-	vec := pgvector.NewVector(doc.Vec)
-
-	query := `
-		INSERT INTO documents (dataset_id, title, url, body, vector)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`
-
-	var insertedID int64
-	err := pg.db.QueryRowContext(ctx, query, doc.DatasetID, doc.Title, doc.URL, doc.Body, vec).Scan(&insertedID)
-	if err != nil {
-		return fmt.Errorf("failed to insert document: %w", err)
-	}
-
-	return nil
-}
-
-func (pg *PostgresDB) SimpleSearchDocuments(queryVector []float32, datasetName string, userId int64, maxResults int) ([]models.Document, error) {
-	if len(queryVector) == 0 {
-		return nil, errors.New("query vector cannot be empty")
-	}
-	if maxResults <= 0 {
-		return nil, errors.New("maxResults must be greater than zero")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	vec := pgvector.NewVector(queryVector)
-
-	query := `
-		SELECT 
-			documents.id, 
-			documents.title, 
-			documents.url, 
-			documents.body, 
-			datasets.id AS dataset_id
-		FROM documents
-		JOIN datasets ON datasets.id = documents.dataset_id
-		WHERE datasets.name = $1 AND datasets.user_id = $2
-		ORDER BY documents.vector <-> $3
-		LIMIT $4
-    `
-
-	rows, err := pg.db.QueryContext(ctx, query, datasetName, userId, vec, maxResults)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute search query: %w", err)
-	}
-	defer rows.Close()
-
-	var documents []models.Document
-	for rows.Next() {
-		var doc models.Document
-		err := rows.Scan(&doc.ID, &doc.Title, &doc.URL, &doc.Body, &doc.DatasetID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan document: %w", err)
-		}
-		documents = append(documents, doc)
-	}
-
-	if rows.Err() != nil {
-		return nil, fmt.Errorf("error iterating through documents: %w", rows.Err())
-	}
-
-	return documents, nil
-}
-
-func (pg *PostgresDB) SearchDocuments(queryVector []float32, datasetName string, userId int64, maxTotalWordCount int) ([]models.Document, error) {
-	if len(queryVector) == 0 {
-		return nil, errors.New("query vector cannot be empty")
-	}
-	if maxTotalWordCount <= 0 {
-		return nil, errors.New("maxTotalWordCount must be greater than zero")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	vec := pgvector.NewVector(queryVector)
-
-	query := `
-        WITH ranked_docs AS (
-            SELECT 
-                documents.id, 
-                documents.title, 
-                documents.url, 
-                documents.body, 
-                datasets.id AS dataset_id,
-                documents.vector <-> $3 AS distance,
-                array_length(regexp_split_to_array(documents.body, '\s+'), 1) AS word_count,
-                SUM(array_length(regexp_split_to_array(documents.body, '\s+'), 1)) OVER (ORDER BY documents.vector <-> $3) AS cumulative_word_count
-            FROM documents
-            JOIN datasets ON datasets.id = documents.dataset_id
-            WHERE datasets.name = $1 AND datasets.user_id = $2
-        )
-        SELECT id, title, url, body, dataset_id
-        FROM ranked_docs
-        WHERE cumulative_word_count <= $4
-        ORDER BY distance
-    `
-
-	rows, err := pg.db.QueryContext(ctx, query, datasetName, userId, vec, maxTotalWordCount)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute search query: %w", err)
-	}
-	defer rows.Close()
-
-	var documents []models.Document
-	for rows.Next() {
-		var doc models.Document
-		err := rows.Scan(&doc.ID, &doc.Title, &doc.URL, &doc.Body, &doc.DatasetID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan document: %w", err)
-		}
-		documents = append(documents, doc)
-	}
-
-	if rows.Err() != nil {
-		return nil, fmt.Errorf("error iterating through documents: %w", rows.Err())
-	}
-
-	return documents, nil
-}
-
-func (pg *PostgresDB) GetSession(id string) (*models.ChatSession, error) {
-	if id == "" {
-		return nil, errors.New("session ID cannot be empty")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	query := `
-		SELECT id, messages, model
-		FROM sessions
-		WHERE id = $1
-	`
-
-	var session models.ChatSession
-	var messages []string
-
-	err := pg.db.QueryRowContext(ctx, query, id).Scan(&session.ID, pq.Array(&messages), &session.Model)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("session with ID %s not found", id)
-		}
-		return nil, fmt.Errorf("failed to retrieve session: %w", err)
-	}
-
-	session.Messages = messages
-	return &session, nil
-}
-
-func (pg *PostgresDB) SaveSession(session models.ChatSession) error {
-	if session.ID == "" {
-		return errors.New("session ID cannot be empty")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	messages := pq.Array(session.Messages)
-
-	query := `
-		INSERT INTO sessions (id, messages, model)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO UPDATE
-		SET messages = EXCLUDED.messages,
-		    model = EXCLUDED.model
-	`
-
-	_, err := pg.db.ExecContext(ctx, query, session.ID, messages, session.Model)
-	if err != nil {
-		return fmt.Errorf("failed to save session: %w", err)
-	}
-
-	return nil
-}
-
-func (pg *PostgresDB) GetOrCreateDataset(datasetName string, userId int64) (int64, error) {
-	if datasetName == "" {
-		return 0, errors.New("dataset name cannot be empty")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	query := `
-		WITH data as (
-			INSERT INTO datasets (name, user_id)
-			VALUES ($1, $2)
-			ON CONFLICT (name, user_id) DO NOTHING
-			RETURNING id
-		)
-		SELECT id FROM data
-			UNION ALL
-		SELECT id FROM datasets WHERE name=$1 AND user_id = $2
-		LIMIT 1;
-	`
-
-	var id int64
-	err := pg.db.QueryRowContext(ctx, query, datasetName, userId).Scan(&id)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get dataset id: %w", err)
-	}
-
-	return id, err
-}
-
 func (pg *PostgresDB) GetAccessTokens() (*[]models.AccessToken, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	query := `
-		SELECT user_id, token, expiration
+		SELECT access_tokens.user_id, access_tokens.token, access_tokens.expiration, users.is_admin
 		FROM access_tokens
-		WHERE expiration > NOW();
+		JOIN users ON users.id = access_tokens.user_id
+		WHERE access_tokens.expiration > NOW();
 	`
 
 	rows, err := pg.db.QueryContext(ctx, query)
@@ -274,7 +62,7 @@ func (pg *PostgresDB) GetAccessTokens() (*[]models.AccessToken, error) {
 	var accessTokens []models.AccessToken
 	for rows.Next() {
 		var accessToken models.AccessToken
-		err := rows.Scan(&accessToken.UserID, &accessToken.Token, &accessToken.Expiration)
+		err := rows.Scan(&accessToken.UserID, &accessToken.Token, &accessToken.Expiration, &accessToken.Admin)
 		if err != nil {
 			return &[]models.AccessToken{}, fmt.Errorf("failed to scan document %w", err)
 		}
@@ -0,0 +1,655 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrhollen/KnowledgeGPT/internal/mmr"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/pgvector/pgvector-go"
+)
+
+// Search modes select how chunks are ranked
+const (
+	SearchModeVector  = "vector"
+	SearchModeLexical = "lexical"
+	SearchModeHybrid  = "hybrid"
+)
+
+// Ways of embedding the query for vector search. HyDEHypothetical embeds an
+// answer the LLM makes up for the question instead of the question itself, and
+// HyDEAverage averages the two embeddings.
+const (
+	HyDEOff          = "off"
+	HyDEHypothetical = "hypothetical"
+	HyDEAverage      = "average"
+)
+
+// maxEfSearch is the largest hnsw.ef_search pgvector accepts, and so the most
+// rows one HNSW scan can return.
+const maxEfSearch = 1000
+
+// chunksPerDocument is how many chunks SimpleSearchDocuments fetches for every
+// document it wants, since several chunks of one document can rank highly.
+const chunksPerDocument = 5
+
+// MaxSearchDepth is the number of documents SimpleSearchDocuments can page
+// through. Every page ranks all the documents before it again from a single
+// index scan, so deeper pages could not be filled reliably.
+const MaxSearchDepth = maxEfSearch / chunksPerDocument
+
+// mmrPoolSize is the number of chunks SimpleSearchDocuments reorders by maximal
+// marginal relevance. The pool is the same for every page, so that the pages
+// of one search are slices of a single ordering.
+const mmrPoolSize = 250
+
+// AllDatasets in SearchQuery.Datasets searches every dataset of the user
+const AllDatasets = "*"
+
+// rrfK dampens the influence of the top ranks in reciprocal rank fusion. 60 is
+// the value used in the original paper.
+const rrfK = 60
+
+// SearchQuery describes a search over the chunks of a user's dataset.
+type SearchQuery struct {
+	// Vector is the query embedding, used by the vector and hybrid modes
+	Vector []float32
+	// Text is the raw query, used by the lexical and hybrid modes
+	Text string
+	Mode string
+	// Datasets are the names of the datasets to search, or AllDatasets
+	Datasets []string
+	UserID   int64
+	Filters  []models.MetadataFilter
+	// MinScore drops vector matches whose similarity is lower, when set
+	MinScore *float64
+	// EfSearch and Probes tune the HNSW and IVFFlat indexes when greater than
+	// zero, trading speed for recall
+	EfSearch int
+	Probes   int
+	// MMRLambda loads the chunk vectors and, in SimpleSearchDocuments, orders
+	// documents by maximal marginal relevance with this lambda, when set
+	MMRLambda *float64
+}
+
+func (q SearchQuery) mode() string {
+	if q.Mode == "" {
+		return SearchModeVector
+	}
+	return q.Mode
+}
+
+// NeedsVector reports whether the query's mode uses the query embedding.
+func (q SearchQuery) NeedsVector() bool {
+	return q.mode() != SearchModeLexical
+}
+
+func (q SearchQuery) validate() error {
+	if err := ValidateSearchMode(q.Mode); err != nil {
+		return err
+	}
+
+	if len(q.Datasets) == 0 {
+		return errors.New("at least one dataset is required")
+	}
+	if q.NeedsVector() && len(q.Vector) == 0 {
+		return errors.New("query vector cannot be empty")
+	}
+	if q.mode() != SearchModeVector && strings.TrimSpace(q.Text) == "" {
+		return errors.New("query text cannot be empty")
+	}
+	if q.EfSearch < 0 || q.EfSearch > maxEfSearch {
+		return fmt.Errorf("ef_search must be between 1 and %d", maxEfSearch)
+	}
+	if q.Probes < 0 {
+		return errors.New("probes must be greater than zero")
+	}
+	if q.MMRLambda != nil && (*q.MMRLambda < 0 || *q.MMRLambda > 1) {
+		return errors.New("lambda must be between 0 and 1")
+	}
+	return nil
+}
+
+// ValidateSearchMode reports whether mode is a supported search mode. An empty
+// mode selects vector search.
+func ValidateSearchMode(mode string) error {
+	switch mode {
+	case "", SearchModeVector, SearchModeLexical, SearchModeHybrid:
+		return nil
+	default:
+		return fmt.Errorf("unknown search mode: %s", mode)
+	}
+}
+
+// ValidateHyDEMode reports whether mode is a supported HyDE mode. An empty mode
+// uses the default of the searched datasets.
+func ValidateHyDEMode(mode string) error {
+	switch mode {
+	case "", HyDEOff, HyDEHypothetical, HyDEAverage:
+		return nil
+	default:
+		return fmt.Errorf("unknown hyde mode: %s", mode)
+	}
+}
+
+// SimpleSearchDocuments returns a page of the best matching documents, skipping
+// the first offset. Only the best chunk of each document is returned as its
+// body. more reports whether another page follows. With MMRLambda set, the
+// documents among the best mmrPoolSize chunks are reordered and paged through.
+func (pg *PostgresDB) SimpleSearchDocuments(q SearchQuery, offset int, limit int) (results []models.SearchResult, more bool, err error) {
+	if err := q.validate(); err != nil {
+		return nil, false, err
+	}
+	if limit <= 0 {
+		return nil, false, errors.New("limit must be greater than zero")
+	}
+	if offset < 0 || offset+limit > MaxSearchDepth {
+		return nil, false, fmt.Errorf("results beyond the first %d cannot be requested", MaxSearchDepth)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Several chunks of one document can rank highly, so fetch extra chunks to
+	// fill the page, and one more document, with distinct documents. The pool
+	// never exceeds what one index scan returns, which MaxSearchDepth allows for
+	wanted := offset + limit + 1
+	pool := min(max(wanted*chunksPerDocument, 50), maxEfSearch)
+	if q.MMRLambda != nil {
+		pool = mmrPoolSize
+	}
+	candidates, err := pg.searchChunks(ctx, q, pool)
+	if err != nil {
+		return nil, false, err
+	}
+
+	documents := []models.SearchResult{}
+	seen := map[int64]bool{}
+	for _, candidate := range candidates {
+		if seen[candidate.ID] {
+			continue
+		}
+		seen[candidate.ID] = true
+		documents = append(documents, candidate)
+	}
+
+	if q.MMRLambda != nil {
+		documents = mmr.Rerank(documents, *q.MMRLambda, wanted)
+	} else {
+		documents = documents[:min(wanted, len(documents))]
+	}
+
+	if offset >= len(documents) {
+		return []models.SearchResult{}, false, nil
+	}
+	documents = documents[offset:]
+	if len(documents) > limit {
+		return documents[:limit], offset+limit < MaxSearchDepth, nil
+	}
+	return documents, false, nil
+}
+
+// CountSearchCandidates returns an upper bound on the number of documents a
+// search can match. Lexical search counts the documents containing the query,
+// but every document is a candidate for vector and hybrid search, so for those
+// it counts all documents passing the filters and ignores MinScore.
+func (pg *PostgresDB) CountSearchCandidates(q SearchQuery) (int, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	args := []any{q.UserID}
+	filters, err := buildSearchFilters(q, &args)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM documents
+		JOIN datasets ON datasets.id = documents.dataset_id
+		WHERE datasets.user_id = $1` + filters
+
+	if q.mode() == SearchModeLexical {
+		args = append(args, q.Text)
+		query += fmt.Sprintf(`
+			AND documents.id IN (
+				SELECT chunks.document_id
+				FROM chunks
+				WHERE chunks.tsv @@ websearch_to_tsquery('english', $%[1]d)
+				UNION
+				SELECT titles.id
+				FROM documents titles
+				WHERE titles.title_tsv @@ websearch_to_tsquery('english', $%[1]d)
+			)`, len(args))
+	}
+
+	var count int
+	if err := pg.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count search candidates: %w", err)
+	}
+
+	return count, nil
+}
+
+// SearchChunks returns up to limit of the best matching chunks, best first,
+// for callers that reorder the candidates before picking the ones to use.
+func (pg *PostgresDB) SearchChunks(q SearchQuery, limit int) ([]models.SearchResult, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, errors.New("limit must be greater than zero")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return pg.searchChunks(ctx, q, limit)
+}
+
+// searchChunks ranks chunks using the query's mode and returns up to limit of
+// them, best first.
+func (pg *PostgresDB) searchChunks(ctx context.Context, q SearchQuery, limit int) ([]models.SearchResult, error) {
+	switch q.mode() {
+	case SearchModeLexical:
+		return pg.lexicalSearch(ctx, q, limit)
+	case SearchModeHybrid:
+		vectorResults, err := pg.vectorSearch(ctx, q, limit)
+		if err != nil {
+			return nil, err
+		}
+		lexicalResults, err := pg.lexicalSearch(ctx, q, limit)
+		if err != nil {
+			return nil, err
+		}
+		return FuseRankings(limit, vectorResults, lexicalResults), nil
+	default:
+		return pg.vectorSearch(ctx, q, limit)
+	}
+}
+
+// vectorSearch ranks chunks by the distance of their embedding to the query
+// vector. Each dataset is searched with its own distance metric, so that its
+// vector index can be used, and the results are merged by similarity, which
+// every metric scores from 0 to 1.
+func (pg *PostgresDB) vectorSearch(ctx context.Context, q SearchQuery, limit int) ([]models.SearchResult, error) {
+	targets, err := pg.searchTargets(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index settings only last for the transaction they are set in
+	tx, err := pg.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// An HNSW scan returns at most ef_search rows, so raise it above the
+	// pgvector default of 40 when more rows are wanted
+	efSearch := q.EfSearch
+	if limit > 40 {
+		efSearch = max(efSearch, min(limit, maxEfSearch))
+	}
+	if efSearch > 0 {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('hnsw.ef_search', $1, true)`, strconv.Itoa(efSearch)); err != nil {
+			return nil, fmt.Errorf("failed to set ef_search: %w", err)
+		}
+	}
+	if q.Probes > 0 {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('ivfflat.probes', $1, true)`, strconv.Itoa(q.Probes)); err != nil {
+			return nil, fmt.Errorf("failed to set probes: %w", err)
+		}
+	}
+
+	results := []models.SearchResult{}
+	for _, target := range targets {
+		args := []any{target.id, pgvector.NewVector(q.Vector), limit}
+		filters, err := buildMetadataFilters(q.Filters, &args)
+		if err != nil {
+			return nil, err
+		}
+
+		metric := distanceMetrics[target.metric]
+		distance := fmt.Sprintf("%s %s $2", vectorExpression(target.dimensions), metric.operator)
+
+		query := `
+			SELECT
+				documents.id,
+				documents.title,
+				documents.url,
+				chunks.body,
+				documents.metadata,
+				datasets.id AS dataset_id,
+				datasets.name AS dataset,
+				chunks.id AS chunk_id,
+				COALESCE(chunks.token_count, length(chunks.body) / 4 + 1) AS token_count,
+				` + q.vectorColumn() + ` AS vector,
+				` + fmt.Sprintf(metric.score, "("+distance+")") + ` AS score
+			FROM chunks
+			JOIN documents ON documents.id = chunks.document_id
+			JOIN datasets ON datasets.id = documents.dataset_id
+			WHERE chunks.dataset_id = $1` + filters + `
+			ORDER BY ` + distance + `
+			LIMIT $3
+		`
+
+		datasetResults, err := querySearchResults(ctx, tx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range datasetResults {
+			if q.MinScore != nil && result.Score < *q.MinScore {
+				// Results are ordered by distance, so the rest score lower too
+				break
+			}
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results[:min(limit, len(results))], nil
+}
+
+type searchTarget struct {
+	id         int64
+	metric     string
+	dimensions sql.NullInt64
+}
+
+// searchTargets looks up the datasets a query searches.
+func (pg *PostgresDB) searchTargets(ctx context.Context, q SearchQuery) ([]searchTarget, error) {
+	args := []any{q.UserID}
+	query := `
+		SELECT id, distance_metric, vector_dimensions
+		FROM datasets
+		WHERE user_id = $1
+	`
+	if !slices.Contains(q.Datasets, AllDatasets) {
+		args = append(args, pq.Array(q.Datasets))
+		query += ` AND name = ANY($2)`
+	}
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up datasets: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []searchTarget
+	for rows.Next() {
+		var target searchTarget
+		if err := rows.Scan(&target.id, &target.metric, &target.dimensions); err != nil {
+			return nil, fmt.Errorf("failed to scan dataset: %w", err)
+		}
+		targets = append(targets, target)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through datasets: %w", rows.Err())
+	}
+
+	return targets, nil
+}
+
+// lexicalSearch ranks chunks by full-text relevance of their body and their
+// document's title to the query text. A chunk matches when the query matches
+// either one. The two are looked up separately and combined, since a single OR
+// across the join could not use the index of each.
+func (pg *PostgresDB) lexicalSearch(ctx context.Context, q SearchQuery, limit int) ([]models.SearchResult, error) {
+	args := []any{q.UserID, q.Text, limit}
+	filters, err := buildSearchFilters(q, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			documents.id,
+			documents.title,
+			documents.url,
+			chunks.body,
+			documents.metadata,
+			datasets.id AS dataset_id,
+			datasets.name AS dataset,
+			chunks.id AS chunk_id,
+			COALESCE(chunks.token_count, length(chunks.body) / 4 + 1) AS token_count,
+			` + q.vectorColumn() + ` AS vector,
+			ts_rank_cd(documents.title_tsv || chunks.tsv, websearch_to_tsquery('english', $2)) AS score
+		FROM (
+			SELECT chunks.id
+			FROM chunks
+			WHERE chunks.tsv @@ websearch_to_tsquery('english', $2)
+			UNION
+			SELECT chunks.id
+			FROM documents
+			JOIN chunks ON chunks.document_id = documents.id
+			WHERE documents.title_tsv @@ websearch_to_tsquery('english', $2)
+		) matches
+		JOIN chunks ON chunks.id = matches.id
+		JOIN documents ON documents.id = chunks.document_id
+		JOIN datasets ON datasets.id = documents.dataset_id
+		WHERE datasets.user_id = $1` + filters + `
+		ORDER BY score DESC
+		LIMIT $3
+	`
+
+	return querySearchResults(ctx, pg.db, query, args...)
+}
+
+// FuseRankings merges rankings with reciprocal rank fusion: each chunk scores
+// the sum of 1 / (rrfK + rank) over every ranking it appears in.
+func FuseRankings(limit int, rankings ...[]models.SearchResult) []models.SearchResult {
+	scores := map[int64]float64{}
+	results := map[int64]models.SearchResult{}
+	var order []int64
+
+	for _, ranking := range rankings {
+		for rank, result := range ranking {
+			if _, ok := results[result.ChunkID]; !ok {
+				results[result.ChunkID] = result
+				order = append(order, result.ChunkID)
+			}
+			scores[result.ChunkID] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	// Stable so ties keep the order of the first ranking
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	fused := make([]models.SearchResult, 0, min(limit, len(order)))
+	for _, chunkId := range order[:min(limit, len(order))] {
+		result := results[chunkId]
+		result.Score = scores[chunkId]
+		fused = append(fused, result)
+	}
+
+	return fused
+}
+
+// vectorColumn selects the chunk vectors only when the query needs them.
+func (q SearchQuery) vectorColumn() string {
+	if q.MMRLambda == nil {
+		return "NULL"
+	}
+	return "chunks.vector"
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func querySearchResults(ctx context.Context, db querier, query string, args ...any) ([]models.SearchResult, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute search query: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var result models.SearchResult
+		var metadata, vector []byte
+		err := rows.Scan(&result.ID, &result.Title, &result.URL, &result.Body, &metadata, &result.DatasetID, &result.Dataset, &result.ChunkID, &result.TokenCount, &vector, &result.Score)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		if vector != nil {
+			var parsed pgvector.Vector
+			if err := parsed.Parse(string(vector)); err != nil {
+				return nil, fmt.Errorf("failed to parse chunk vector: %w", err)
+			}
+			result.Vector = parsed.Slice()
+		}
+		if result.Metadata, err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through documents: %w", rows.Err())
+	}
+
+	return results, nil
+}
+
+// buildSearchFilters returns the dataset and metadata conditions of q, each
+// starting with AND, appending their parameters to args.
+func buildSearchFilters(q SearchQuery, args *[]any) (string, error) {
+	filters, err := buildMetadataFilters(q.Filters, args)
+	if err != nil {
+		return "", err
+	}
+
+	if slices.Contains(q.Datasets, AllDatasets) {
+		return filters, nil
+	}
+
+	*args = append(*args, pq.Array(q.Datasets))
+	return fmt.Sprintf(" AND datasets.name = ANY($%d)", len(*args)) + filters, nil
+}
+
+// ValidateMetadataFilters reports whether filters can be turned into a query,
+// so invalid filters can be rejected before searching.
+func ValidateMetadataFilters(filters []models.MetadataFilter) error {
+	var args []any
+	_, err := buildMetadataFilters(filters, &args)
+	return err
+}
+
+// buildMetadataFilters turns metadata filters into SQL conditions on
+// documents.metadata, each starting with AND. Keys and values are always
+// passed as parameters, which are appended to args.
+func buildMetadataFilters(filters []models.MetadataFilter, args *[]any) (string, error) {
+	var sql strings.Builder
+
+	param := func(value any) string {
+		*args = append(*args, value)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+
+	for _, filter := range filters {
+		if filter.Key == "" {
+			return "", errors.New("metadata filter key cannot be empty")
+		}
+
+		switch filter.Op {
+		case models.FilterEqual:
+			value, err := json.Marshal(map[string]any{filter.Key: filter.Value})
+			if err != nil {
+				return "", fmt.Errorf("invalid value for metadata filter %q: %w", filter.Key, err)
+			}
+			fmt.Fprintf(&sql, " AND documents.metadata @> %s::jsonb", param(string(value)))
+		case models.FilterIn:
+			values, ok := filter.Value.([]any)
+			if !ok || len(values) == 0 {
+				return "", fmt.Errorf("metadata filter %q needs a non-empty list for in", filter.Key)
+			}
+
+			key := param(filter.Key)
+			conditions := make([]string, len(values))
+			for i, v := range values {
+				value, err := json.Marshal(v)
+				if err != nil {
+					return "", fmt.Errorf("invalid value for metadata filter %q: %w", filter.Key, err)
+				}
+				conditions[i] = fmt.Sprintf("documents.metadata -> %s = %s::jsonb", key, param(string(value)))
+			}
+			fmt.Fprintf(&sql, " AND (%s)", strings.Join(conditions, " OR "))
+		case models.FilterGreater, models.FilterGreaterEqual, models.FilterLess, models.FilterLessEqual:
+			operator := map[string]string{
+				models.FilterGreater:      ">",
+				models.FilterGreaterEqual: ">=",
+				models.FilterLess:         "<",
+				models.FilterLessEqual:    "<=",
+			}[filter.Op]
+
+			// The CASE keeps Postgres from casting values of the wrong type
+			key := param(filter.Key)
+			switch value := filter.Value.(type) {
+			case float64, int, int64:
+				fmt.Fprintf(&sql,
+					" AND CASE WHEN jsonb_typeof(documents.metadata -> %s) = 'number' THEN (documents.metadata ->> %s)::numeric %s %s ELSE false END",
+					key, key, operator, param(value))
+			case string:
+				fmt.Fprintf(&sql,
+					" AND CASE WHEN jsonb_typeof(documents.metadata -> %s) = 'string' THEN documents.metadata ->> %s %s %s ELSE false END",
+					key, key, operator, param(value))
+			default:
+				return "", fmt.Errorf("metadata filter %q needs a number or string for %s", filter.Key, filter.Op)
+			}
+		default:
+			return "", fmt.Errorf("unknown metadata filter operator: %s", filter.Op)
+		}
+	}
+
+	return sql.String(), nil
+}
+
+func encodeMetadata(metadata map[string]any) ([]byte, error) {
+	if metadata == nil {
+		return []byte("{}"), nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document metadata: %w", err)
+	}
+	return data, nil
+}
+
+func decodeMetadata(data []byte) (map[string]any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode document metadata: %w", err)
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	return metadata, nil
+}
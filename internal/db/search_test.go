@@ -0,0 +1,176 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+func result(chunkId int64) models.SearchResult {
+	return models.SearchResult{Document: models.Document{ID: chunkId * 10}, ChunkID: chunkId}
+}
+
+func TestFuseRankings(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		rankings [][]models.SearchResult
+		want     []int64
+	}{
+		{
+			name:  "no rankings",
+			limit: 5,
+			want:  []int64{},
+		},
+		{
+			name:     "single ranking keeps order",
+			limit:    5,
+			rankings: [][]models.SearchResult{{result(1), result(2), result(3)}},
+			want:     []int64{1, 2, 3},
+		},
+		{
+			name:  "chunks in both rankings rise",
+			limit: 5,
+			rankings: [][]models.SearchResult{
+				{result(1), result(2), result(3)},
+				{result(3), result(4)},
+			},
+			want: []int64{3, 1, 2, 4},
+		},
+		{
+			name:  "ties keep the first ranking's order",
+			limit: 5,
+			rankings: [][]models.SearchResult{
+				{result(1), result(2)},
+				{result(2), result(1)},
+			},
+			want: []int64{1, 2},
+		},
+		{
+			name:  "limit",
+			limit: 2,
+			rankings: [][]models.SearchResult{
+				{result(1), result(2), result(3)},
+			},
+			want: []int64{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := FuseRankings(tt.limit, tt.rankings...)
+
+			got := []int64{}
+			for _, result := range fused {
+				got = append(got, result.ChunkID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FuseRankings() = %v, want %v", got, tt.want)
+			}
+
+			for i := 1; i < len(fused); i++ {
+				if fused[i].Score > fused[i-1].Score {
+					t.Errorf("scores are not descending: %v", fused)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRankingsScores(t *testing.T) {
+	fused := FuseRankings(1, []models.SearchResult{result(1)}, []models.SearchResult{result(1)})
+
+	want := 2.0 / (rrfK + 1)
+	if len(fused) != 1 || fused[0].Score != want {
+		t.Errorf("FuseRankings() = %v, want a single result scoring %v", fused, want)
+	}
+}
+
+func TestBuildMetadataFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  []models.MetadataFilter
+		want     string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{
+			name:     "none",
+			want:     "",
+			wantArgs: []any{"existing"},
+		},
+		{
+			name:     "equal",
+			filters:  []models.MetadataFilter{{Key: "author", Op: models.FilterEqual, Value: "alice"}},
+			want:     " AND documents.metadata @> $2::jsonb",
+			wantArgs: []any{"existing", `{"author":"alice"}`},
+		},
+		{
+			name:     "in",
+			filters:  []models.MetadataFilter{{Key: "tag", Op: models.FilterIn, Value: []any{"a", 1.0}}},
+			want:     " AND (documents.metadata -> $2 = $3::jsonb OR documents.metadata -> $2 = $4::jsonb)",
+			wantArgs: []any{"existing", "tag", `"a"`, "1"},
+		},
+		{
+			name:     "number range",
+			filters:  []models.MetadataFilter{{Key: "year", Op: models.FilterGreaterEqual, Value: 2020.0}},
+			want:     " AND CASE WHEN jsonb_typeof(documents.metadata -> $2) = 'number' THEN (documents.metadata ->> $2)::numeric >= $3 ELSE false END",
+			wantArgs: []any{"existing", "year", 2020.0},
+		},
+		{
+			name:     "string range",
+			filters:  []models.MetadataFilter{{Key: "date", Op: models.FilterLess, Value: "2024-01-01"}},
+			want:     " AND CASE WHEN jsonb_typeof(documents.metadata -> $2) = 'string' THEN documents.metadata ->> $2 < $3 ELSE false END",
+			wantArgs: []any{"existing", "date", "2024-01-01"},
+		},
+		{
+			name: "several",
+			filters: []models.MetadataFilter{
+				{Key: "author", Op: models.FilterEqual, Value: "alice"},
+				{Key: "year", Op: models.FilterGreater, Value: 2020.0},
+			},
+			want:     " AND documents.metadata @> $2::jsonb AND CASE WHEN jsonb_typeof(documents.metadata -> $3) = 'number' THEN (documents.metadata ->> $3)::numeric > $4 ELSE false END",
+			wantArgs: []any{"existing", `{"author":"alice"}`, "year", 2020.0},
+		},
+		{
+			name:    "empty key",
+			filters: []models.MetadataFilter{{Op: models.FilterEqual, Value: "alice"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty in list",
+			filters: []models.MetadataFilter{{Key: "tag", Op: models.FilterIn, Value: []any{}}},
+			wantErr: true,
+		},
+		{
+			name:    "range over a list",
+			filters: []models.MetadataFilter{{Key: "year", Op: models.FilterLessEqual, Value: []any{1.0}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			filters: []models.MetadataFilter{{Key: "year", Op: "like", Value: "a"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{"existing"}
+			got, err := buildMetadataFilters(tt.filters, &args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMetadataFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("buildMetadataFilters() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+// maxSessionTitleLength is the number of characters of the first question a new
+// session is titled with
+const maxSessionTitleLength = 80
+
+// Summarizes each session with the number of questions asked in it
+const sessionSummaryQuery = `
+	SELECT
+		sessions.id,
+		COALESCE(sessions.title, ''),
+		sessions.model,
+		COUNT(session_messages.id) FILTER (WHERE session_messages.role = 'user'),
+		sessions.created_at,
+		sessions.updated_at
+	FROM sessions
+	LEFT JOIN session_messages ON session_messages.session_id = sessions.id
+`
+
+// ListSessions returns the user's chat sessions without their messages, most
+// recently used first.
+func (pg *PostgresDB) ListSessions(userId int64) ([]models.ChatSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := sessionSummaryQuery + `
+		WHERE sessions.user_id = $1
+		GROUP BY sessions.id
+		ORDER BY sessions.updated_at DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.ChatSession{}
+	for rows.Next() {
+		var session models.ChatSession
+		err := rows.Scan(&session.ID, &session.Title, &session.Model, &session.TurnCount, &session.CreatedAt, &session.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through sessions: %w", rows.Err())
+	}
+
+	return sessions, nil
+}
+
+// GetSession returns the chat session with the given ID, with its messages in
+// order, if it belongs to the user.
+func (pg *PostgresDB) GetSession(id string, userId int64) (*models.ChatSession, error) {
+	if id == "" {
+		return nil, errors.New("session ID cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := sessionSummaryQuery + `
+		WHERE sessions.id = $1 AND sessions.user_id = $2
+		GROUP BY sessions.id
+	`
+
+	var session models.ChatSession
+	err := pg.db.QueryRowContext(ctx, query, id, userId).
+		Scan(&session.ID, &session.Title, &session.Model, &session.TurnCount, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve session: %w", err)
+	}
+
+	query = `
+		SELECT role, content, document_ids, created_at
+		FROM session_messages
+		WHERE session_id = $1
+		ORDER BY id
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	session.Messages = []models.ChatMessage{}
+	for rows.Next() {
+		var message models.ChatMessage
+		err := rows.Scan(&message.Role, &message.Content, pq.Array(&message.DocumentIDs), &message.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session message: %w", err)
+		}
+		session.Messages = append(session.Messages, message)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating through session messages: %w", rows.Err())
+	}
+
+	return &session, nil
+}
+
+// AppendSessionMessages adds messages to the end of a chat session. The session
+// is created for the user when it does not exist yet, titled with its first
+// question. ErrNotFound is returned when the session belongs to another user.
+func (pg *PostgresDB) AppendSessionMessages(id string, userId int64, model string, messages ...models.ChatMessage) error {
+	if id == "" {
+		return errors.New("session ID cannot be empty")
+	}
+
+	title := ""
+	for _, message := range messages {
+		if message.Role == "user" {
+			title = truncate(message.Content, maxSessionTitleLength)
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Taking the row lock also keeps concurrent turns of a session in order
+	query := `
+		INSERT INTO sessions (id, user_id, title, model)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (id) DO UPDATE
+		SET model = EXCLUDED.model,
+		    updated_at = now()
+		WHERE sessions.user_id = EXCLUDED.user_id
+		RETURNING id
+	`
+
+	err = tx.QueryRowContext(ctx, query, id, userId, title, model).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	query = `
+		INSERT INTO session_messages (session_id, role, content, document_ids)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	for _, message := range messages {
+		documentIds := message.DocumentIDs
+		if documentIds == nil {
+			documentIds = []int64{}
+		}
+
+		_, err := tx.ExecContext(ctx, query, id, message.Role, message.Content, pq.Array(documentIds))
+		if err != nil {
+			return fmt.Errorf("failed to save session message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+
+	return nil
+}
+
+// RenameSession changes the title of a chat session of the user.
+func (pg *PostgresDB) RenameSession(id string, userId int64, title string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE sessions
+		SET title = $3
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, id, userId, title)
+	if err != nil {
+		return fmt.Errorf("failed to rename session: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to rename session: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteSession removes a chat session of the user along with its messages.
+func (pg *PostgresDB) DeleteSession(id string, userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM sessions
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// truncate shortens text to at most length characters.
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length])
+}
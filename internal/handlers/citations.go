@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/query"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/mrhollen/KnowledgeGPT/internal/snippet"
+	"github.com/mrhollen/KnowledgeGPT/internal/verify"
+)
+
+// citationRenderer renders the citation markers of an answer based on the
+// documents given to the LLM, and keeps track of the documents cited.
+type citationRenderer struct {
+	// sources are the documents given to the LLM, once each, in prompt order
+	sources []models.SearchResult
+	format  string
+	cited   []bool
+}
+
+// newCitationRenderer renders the citations of docs in format. A document
+// given to the LLM as several chunks becomes a single source, taken from its
+// best ranked chunk.
+func newCitationRenderer(docs []models.SearchResult, format string) *citationRenderer {
+	sources := []models.SearchResult{}
+	seen := map[int64]bool{}
+	for _, doc := range docs {
+		if !seen[doc.ID] {
+			seen[doc.ID] = true
+			sources = append(sources, doc)
+		}
+	}
+
+	return &citationRenderer{
+		sources: sources,
+		format:  format,
+		cited:   make([]bool, len(sources)),
+	}
+}
+
+// Render replaces the citation markers in text. In the text format a marker
+// becomes the number of its source in brackets, and in the markdown format a
+// link to the document. Markers citing documents that are not sources are
+// kept. The citations are returned with their positions in the rendered text.
+func (c *citationRenderer) Render(text string) (string, []api.Citation) {
+	text = strings.ReplaceAll(text, "\\n", "\n")
+
+	// Positions are counted in runes as the text is written, rather than by
+	// recounting everything rendered so far for every citation
+	var rendered strings.Builder
+	runes := 0
+	write := func(s string) {
+		rendered.WriteString(s)
+		runes += utf8.RuneCountInString(s)
+	}
+
+	citations := []api.Citation{}
+	last := 0
+	for _, match := range verify.CitationPattern.FindAllStringSubmatchIndex(text, -1) {
+		write(text[last:match[0]])
+		last = match[1]
+
+		id, _ := strconv.ParseInt(text[match[2]:match[3]], 10, 64)
+		index := c.sourceIndex(id)
+		if index < 0 {
+			write(text[match[0]:match[1]])
+			continue
+		}
+		c.cited[index] = true
+
+		start := runes
+		if c.format == api.FormatMarkdown {
+			write(fmt.Sprintf("[%s](%s)", c.sources[index].Title, c.sources[index].URL))
+		} else {
+			write(fmt.Sprintf("[%d]", index+1))
+		}
+
+		citations = append(citations, api.Citation{
+			Source: index,
+			Start:  start,
+			End:    runes,
+		})
+	}
+	write(text[last:])
+
+	return rendered.String(), citations
+}
+
+// Sources returns the sources for the response to query, each with the
+// passage that best matches the query.
+func (c *citationRenderer) Sources(query string) []api.Source {
+	sources := make([]api.Source, 0, len(c.sources))
+	for i, doc := range c.sources {
+		source := api.Source{
+			ID:      doc.ID,
+			Dataset: doc.Dataset,
+			Title:   doc.Title,
+			URL:     doc.URL,
+			Score:   doc.Score,
+			Cited:   c.cited[i],
+		}
+		if snippets := snippet.Extract(doc.Body, query, snippet.DefaultLength, 1); len(snippets) > 0 {
+			source.Snippet = snippets[0].Text
+		}
+
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// sourceIndex returns the index of the source of the document with the given
+// ID, or -1 when the document is not a source.
+func (c *citationRenderer) sourceIndex(id int64) int {
+	for i, source := range c.sources {
+		if source.ID == id {
+			return i
+		}
+	}
+	return -1
+}
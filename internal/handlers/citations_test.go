@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/query"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+func testSources() []models.SearchResult {
+	doc := func(id int64, title string, url string) models.SearchResult {
+		return models.SearchResult{Document: models.Document{ID: id, Title: title, URL: url}}
+	}
+	// The second chunk of document 7 does not make it a source of its own
+	return []models.SearchResult{doc(7, "Go", "https://go.dev"), doc(9, "Café", "https://cafe.example"), doc(7, "Go", "https://go.dev")}
+}
+
+func TestCitationRendererRender(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		text          string
+		want          string
+		wantCitations []api.Citation
+		wantCited     []bool
+	}{
+		{
+			name:          "no citations",
+			format:        api.FormatText,
+			text:          "Plain answer.",
+			want:          "Plain answer.",
+			wantCitations: []api.Citation{},
+			wantCited:     []bool{false, false},
+		},
+		{
+			name:   "text",
+			format: api.FormatText,
+			text:   "Go is fast[citation]7[/citation]. Coffee[citation]9[/citation][citation]7[/citation].",
+			want:   "Go is fast[1]. Coffee[2][1].",
+			wantCitations: []api.Citation{
+				{Source: 0, Start: 10, End: 13},
+				{Source: 1, Start: 21, End: 24},
+				{Source: 0, Start: 24, End: 27},
+			},
+			wantCited: []bool{true, true},
+		},
+		{
+			name:   "markdown",
+			format: api.FormatMarkdown,
+			text:   "Coffee[citation]9[/citation] is good.",
+			want:   "Coffee[Café](https://cafe.example) is good.",
+			wantCitations: []api.Citation{
+				{Source: 1, Start: 6, End: 34},
+			},
+			wantCited: []bool{false, true},
+		},
+		{
+			name:   "positions count characters",
+			format: api.FormatText,
+			text:   "Ünïcödé[citation]9[/citation] then[citation]7[/citation]",
+			want:   "Ünïcödé[2] then[1]",
+			wantCitations: []api.Citation{
+				{Source: 1, Start: 7, End: 10},
+				{Source: 0, Start: 15, End: 18},
+			},
+			wantCited: []bool{true, true},
+		},
+		{
+			name:          "unknown documents are kept",
+			format:        api.FormatText,
+			text:          "Made up[citation]42[/citation].",
+			want:          "Made up[citation]42[/citation].",
+			wantCitations: []api.Citation{},
+			wantCited:     []bool{false, false},
+		},
+		{
+			name:          "escaped newlines",
+			format:        api.FormatText,
+			text:          `One\ntwo`,
+			want:          "One\ntwo",
+			wantCitations: []api.Citation{},
+			wantCited:     []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := newCitationRenderer(testSources(), tt.format)
+			got, citations := renderer.Render(tt.text)
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(citations, tt.wantCitations) {
+				t.Errorf("Render() citations = %v, want %v", citations, tt.wantCitations)
+			}
+			if !reflect.DeepEqual(renderer.cited, tt.wantCited) {
+				t.Errorf("cited = %v, want %v", renderer.cited, tt.wantCited)
+			}
+		})
+	}
+}
+
+func TestCitationStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		// want is the text sent for each token, followed by the flushed text
+		want []string
+	}{
+		{
+			name:   "plain tokens pass through",
+			tokens: []string{"Hello", " world."},
+			want:   []string{"Hello", " world.", ""},
+		},
+		{
+			name:   "marker split across tokens",
+			tokens: []string{"Go is fast[cit", "ation]7[/cit", "ation]. Done."},
+			want:   []string{"Go is fast", "", "[1]. Done.", ""},
+		},
+		{
+			name:   "bracket that is not a marker",
+			tokens: []string{"An array[0", "] is", " here."},
+			want:   []string{"An array[0", "] is", " here.", ""},
+		},
+		{
+			name:   "escaped newline split after the backslash",
+			tokens: []string{`One\`, `ntwo`},
+			want:   []string{"One", "\ntwo", ""},
+		},
+		{
+			name:   "unfinished marker is flushed",
+			tokens: []string{"Trailing [citation]7"},
+			want:   []string{"Trailing ", "[citation]7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &citationStream{renderer: newCitationRenderer(testSources(), api.FormatText)}
+
+			var got []string
+			for _, token := range tt.tokens {
+				text, _ := stream.Next(token)
+				got = append(got, text)
+			}
+			text, _ := stream.Flush()
+			got = append(got, text)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCitationStreamPositions(t *testing.T) {
+	stream := &citationStream{renderer: newCitationRenderer(testSources(), api.FormatText)}
+
+	stream.Next("Fast[citation]7")
+	text, citations := stream.Next("[/citation] and more")
+
+	want := []api.Citation{{Source: 0, Start: 0, End: 3}}
+	if text != "[1] and more" || !reflect.DeepEqual(citations, want) {
+		t.Errorf("Next() = %q, %v, want %q, %v", text, citations, "[1] and more", want)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/datasets"
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+type DatasetHandler struct {
+	DB *db.PostgresDB
+}
+
+func (h *DatasetHandler) ListDatasets(userId int64, w http.ResponseWriter, r *http.Request) {
+	datasets, err := h.DB.ListDatasets(userId)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to list datasets", http.StatusInternalServerError)
+		return
+	}
+
+	response := api.ListDatasetsResponse{
+		Datasets: []api.DatasetResponse{},
+	}
+	for _, dataset := range datasets {
+		response.Datasets = append(response.Datasets, toDatasetResponse(dataset))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *DatasetHandler) GetDataset(userId int64, w http.ResponseWriter, r *http.Request) {
+	h.writeDataset(userId, r.PathValue("name"), w)
+}
+
+func (h *DatasetHandler) UpdateDataset(userId int64, w http.ResponseWriter, r *http.Request) {
+	var req api.UpdateDatasetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil {
+		trimmed := strings.TrimSpace(*req.Name)
+		if trimmed == "" {
+			http.Error(w, "Dataset name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		req.Name = &trimmed
+	}
+	if req.DistanceMetric != nil {
+		if err := db.ValidateDistanceMetric(*req.DistanceMetric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.IndexType != nil {
+		if err := db.ValidateIndexType(*req.IndexType); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.HyDEMode != nil {
+		if *req.HyDEMode == "" {
+			http.Error(w, "hyde_mode cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if err := db.ValidateHyDEMode(*req.HyDEMode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	name := r.PathValue("name")
+	err := h.DB.UpdateDataset(name, userId, models.DatasetUpdate{
+		Name:           req.Name,
+		Description:    req.Description,
+		DistanceMetric: req.DistanceMetric,
+		IndexType:      req.IndexType,
+		HyDEMode:       req.HyDEMode,
+	})
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, db.ErrConflict) {
+		http.Error(w, "A dataset with that name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to update dataset", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Name != nil {
+		name = *req.Name
+	}
+	h.writeDataset(userId, name, w)
+}
+
+func (h *DatasetHandler) DeleteDataset(userId int64, w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteDataset(r.PathValue("name"), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to delete dataset", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *DatasetHandler) writeDataset(userId int64, name string, w http.ResponseWriter) {
+	dataset, err := h.DB.GetDataset(name, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to get dataset", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toDatasetResponse(*dataset))
+}
+
+func toDatasetResponse(dataset models.Dataset) api.DatasetResponse {
+	return api.DatasetResponse{
+		Name:           dataset.Name,
+		Description:    dataset.Description,
+		DistanceMetric: dataset.DistanceMetric,
+		IndexType:      dataset.IndexType,
+		HyDEMode:       dataset.HyDEMode,
+		DocumentCount:  dataset.DocumentCount,
+		CreatedAt:      dataset.CreatedAt,
+		LastUpdated:    dataset.LastUpdated,
+	}
+}
@@ -1,19 +1,54 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
 
 	api "github.com/mrhollen/KnowledgeGPT/internal/api/documents"
+	"github.com/mrhollen/KnowledgeGPT/internal/chunking"
 	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/internal/jobs"
 	"github.com/mrhollen/KnowledgeGPT/internal/llm"
 	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/mrhollen/KnowledgeGPT/internal/tokenizer"
 )
 
 type DocumentHandler struct {
-	Client llm.Client
-	DB     *db.PostgresDB
+	Client  llm.Client
+	DB      *db.PostgresDB
+	Chunker *chunking.Chunker
+	Jobs    *jobs.Worker
+}
+
+// IngestError describes why a document could not be ingested along with the
+// HTTP status that should be reported for it.
+type IngestError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *IngestError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *IngestError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether ingesting the document again may succeed, as it
+// can after server-side failures such as an unreachable embedding API.
+func (e *IngestError) Temporary() bool {
+	return e.Status >= http.StatusInternalServerError
 }
 
 func (h *DocumentHandler) AddDocument(userId int64, w http.ResponseWriter, r *http.Request) {
@@ -33,44 +68,462 @@ func (h *DocumentHandler) AddDocuments(userId int64, w http.ResponseWriter, r *h
 		return
 	}
 
-	for _, request := range req {
-		h.createDocument(userId, request, w)
+	// Large loads can be queued and tracked through /jobs/{id} instead
+	async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	if async {
+		if len(req) == 0 {
+			http.Error(w, "No documents to add", http.StatusBadRequest)
+			return
+		}
+
+		jobId, err := h.Jobs.Enqueue(userId, req)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to queue documents", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(api.AddDocumentsAsyncResponse{JobID: jobId})
+		return
+	}
+
+	responses, errs := h.IngestBatch(userId, req)
+
+	// Documents the client got wrong are reported on their own, so the rest of
+	// the batch still goes through. Server errors fail the whole request.
+	status := http.StatusOK
+	for i, response := range responses {
+		var ingestErr *IngestError
+		if errs[i] != nil && errors.As(errs[i], &ingestErr) && ingestErr.Status < http.StatusInternalServerError {
+			responses[i] = api.AddDocumentResponse{Status: api.StatusFailed, Error: ingestErr.Message}
+			continue
+		}
+		if errs[i] != nil {
+			writeIngestError(w, errs[i])
+			return
+		}
+
+		if response.Status == api.StatusCreated {
+			status = http.StatusCreated
+		}
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(responses)
 }
 
-func (h *DocumentHandler) createDocument(userId int64, req api.AddDocumentRequest, w http.ResponseWriter) {
-	vec, err := h.Client.GetEmbedding(req.Body, "")
+// pendingDocument is a document waiting for its chunks to be embedded.
+type pendingDocument struct {
+	doc     models.Document
+	chunks  []models.Chunk
+	replace bool
+}
+
+// Ingest chunks, embeds and stores a document.
+func (h *DocumentHandler) Ingest(userId int64, req api.AddDocumentRequest) (api.AddDocumentResponse, error) {
+	responses, errs := h.IngestBatch(userId, []api.AddDocumentRequest{req})
+	return responses[0], errs[0]
+}
+
+// IngestBatch stores several documents, embedding the chunks of all of them
+// together so large loads need as few embedding requests as possible. Documents
+// whose content is already stored are left alone. The returned responses and
+// errors are in the same order as the requests.
+func (h *DocumentHandler) IngestBatch(userId int64, reqs []api.AddDocumentRequest) ([]api.AddDocumentResponse, []error) {
+	responses := make([]api.AddDocumentResponse, len(reqs))
+	errs := make([]error, len(reqs))
+
+	pending := make([]*pendingDocument, len(reqs))
+	var bodies []string
+	for i, req := range reqs {
+		pending[i], responses[i], errs[i] = h.prepareDocument(userId, req)
+		if pending[i] == nil {
+			continue
+		}
+
+		for _, chunk := range pending[i].chunks {
+			bodies = append(bodies, chunk.Body)
+		}
+	}
+
+	vecs, err := h.Client.GetEmbeddings(bodies, "")
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Could not get document embedding", http.StatusInternalServerError)
-		return
+		for i := range pending {
+			if pending[i] != nil {
+				errs[i] = &IngestError{http.StatusInternalServerError, "Could not get document embedding", err}
+			}
+		}
+		return responses, errs
+	}
+
+	next := 0
+	for _, p := range pending {
+		if p == nil {
+			continue
+		}
+		for j := range p.chunks {
+			p.chunks[j].Vec = vecs[next]
+			next++
+		}
 	}
 
+	for i, p := range pending {
+		if p != nil {
+			responses[i], errs[i] = h.storeDocument(userId, p)
+		}
+	}
+
+	return responses, errs
+}
+
+// prepareDocument decides what ingesting a request involves. Requests that
+// need new embeddings are returned as a pendingDocument; anything else is
+// resolved immediately.
+func (h *DocumentHandler) prepareDocument(userId int64, req api.AddDocumentRequest) (*pendingDocument, api.AddDocumentResponse, error) {
 	datasetName := req.Dataset
 	if datasetName == "" {
 		datasetName = "default"
 	}
 
 	datasetId, err := h.DB.GetOrCreateDataset(datasetName, userId)
+	if err != nil {
+		return nil, api.AddDocumentResponse{}, &IngestError{http.StatusInternalServerError, "Error getting or creating dataset", err}
+	}
+
+	doc := models.Document{
+		DatasetID:   datasetId,
+		ExternalID:  req.ExternalID,
+		Title:       req.Title,
+		URL:         req.URL,
+		Body:        req.Body,
+		Metadata:    req.Metadata,
+		ContentHash: contentHash(req.Body),
+	}
+
+	existing, err := h.DB.FindDocument(datasetId, doc.ExternalID, doc.ContentHash)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, api.AddDocumentResponse{}, &IngestError{http.StatusInternalServerError, "Failed to look up existing document", err}
+	}
+
+	if existing != nil && existing.ContentHash == doc.ContentHash {
+		// Same content under the same external ID may still carry new details
+		if doc.ExternalID != "" && doc.ExternalID == existing.ExternalID && detailsChanged(*existing, doc) {
+			doc.ID = existing.ID
+			if err := h.DB.UpdateDocumentDetails(doc, userId); err != nil {
+				return nil, api.AddDocumentResponse{}, &IngestError{http.StatusInternalServerError, "Failed to update document", err}
+			}
+			return nil, api.AddDocumentResponse{ID: existing.ID, Status: api.StatusUpdated}, nil
+		}
+
+		return nil, api.AddDocumentResponse{ID: existing.ID, Status: api.StatusUnchanged}, nil
+	}
+
+	chunks := h.chunkBody(req.Body)
+	if len(chunks) == 0 {
+		return nil, api.AddDocumentResponse{}, &IngestError{http.StatusBadRequest, "Document body cannot be empty", nil}
+	}
+
+	pending := &pendingDocument{
+		doc:    doc,
+		chunks: chunks,
+	}
+	if existing != nil {
+		pending.doc.ID = existing.ID
+		pending.replace = true
+	}
+
+	return pending, api.AddDocumentResponse{}, nil
+}
+
+func (h *DocumentHandler) storeDocument(userId int64, p *pendingDocument) (api.AddDocumentResponse, error) {
+	if p.replace {
+		err := h.DB.ReplaceDocument(p.doc, userId, p.chunks)
+		if errors.Is(err, db.ErrConflict) {
+			return api.AddDocumentResponse{}, &IngestError{http.StatusConflict, "A document with the same content already exists in this dataset", err}
+		}
+		if errors.Is(err, db.ErrNotFound) {
+			return api.AddDocumentResponse{}, &IngestError{http.StatusConflict, "Document was modified by another request or earlier in the same batch", err}
+		}
+		if err != nil {
+			return api.AddDocumentResponse{}, &IngestError{http.StatusInternalServerError, "Failed to update document", err}
+		}
+		return api.AddDocumentResponse{ID: p.doc.ID, Status: api.StatusUpdated}, nil
+	}
+
+	id, err := h.DB.AddDocument(p.doc, p.chunks)
+	if errors.Is(err, db.ErrConflict) {
+		// The same document was stored since it was prepared, most likely
+		// earlier in the same batch
+		existing, findErr := h.DB.FindDocument(p.doc.DatasetID, p.doc.ExternalID, p.doc.ContentHash)
+		if findErr == nil && existing.ContentHash == p.doc.ContentHash {
+			return api.AddDocumentResponse{ID: existing.ID, Status: api.StatusUnchanged}, nil
+		}
+		return api.AddDocumentResponse{}, &IngestError{http.StatusConflict, "Document was modified by another request or earlier in the same batch", err}
+	}
+	if err != nil {
+		return api.AddDocumentResponse{}, &IngestError{http.StatusInternalServerError, "Failed to add document", err}
+	}
+
+	return api.AddDocumentResponse{ID: id, Status: api.StatusCreated}, nil
+}
+
+func (h *DocumentHandler) chunkBody(body string) []models.Chunk {
+	var chunks []models.Chunk
+	for i, text := range h.Chunker.Split(body) {
+		chunks = append(chunks, models.Chunk{
+			Index:      i,
+			Body:       text,
+			TokenCount: tokenizer.Count(text),
+		})
+	}
+
+	return chunks
+}
+
+// embedBody splits a body into chunks and embeds all of them.
+func (h *DocumentHandler) embedBody(body string) ([]models.Chunk, error) {
+	chunks := h.chunkBody(body)
+	if len(chunks) == 0 {
+		return nil, &IngestError{http.StatusBadRequest, "Document body cannot be empty", nil}
+	}
+
+	bodies := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		bodies[i] = chunk.Body
+	}
+
+	vecs, err := h.Client.GetEmbeddings(bodies, "")
+	if err != nil {
+		return nil, &IngestError{http.StatusInternalServerError, "Could not get document embedding", err}
+	}
+
+	for i := range chunks {
+		chunks[i].Vec = vecs[i]
+	}
+
+	return chunks, nil
+}
+
+// detailsChanged reports whether the title, URL or metadata of two versions of
+// a document differ.
+func detailsChanged(before models.Document, after models.Document) bool {
+	if before.Title != after.Title || before.URL != after.URL {
+		return true
+	}
+	if len(before.Metadata) == 0 && len(after.Metadata) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(before.Metadata, after.Metadata)
+}
+
+// contentHash fingerprints a document body for duplicate detection.
+func contentHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *DocumentHandler) createDocument(userId int64, req api.AddDocumentRequest, w http.ResponseWriter) {
+	response, err := h.Ingest(userId, req)
+	if err != nil {
+		writeIngestError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if response.Status == api.StatusCreated {
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *DocumentHandler) ListDocuments(userId int64, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	docs, err := h.DB.ListDocuments(userId, query.Get("dataset"), limit, offset)
 	if err != nil {
 		fmt.Println(err)
-		http.Error(w, "Error getting or creating dataset", http.StatusInternalServerError)
+		http.Error(w, "Failed to list documents", http.StatusInternalServerError)
 		return
 	}
 
-	doc := models.Document{
-		Title:     req.Title,
-		URL:       req.URL,
-		Body:      req.Body,
-		Vec:       vec,
-		DatasetID: datasetId,
+	response := api.ListDocumentsResponse{
+		Documents: []api.DocumentResponse{},
+	}
+	for _, doc := range docs {
+		response.Documents = append(response.Documents, toDocumentResponse(doc))
 	}
 
-	if err := h.DB.AddDocument(doc); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *DocumentHandler) GetDocument(userId int64, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.DB.GetDocument(id, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		fmt.Println(err)
-		http.Error(w, "Failed to add document", http.StatusInternalServerError)
+		http.Error(w, "Failed to get document", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toDocumentResponse(*doc))
+}
+
+// UpdateDocument handles PUT when partial is false and PATCH when it is true.
+// The document is only re-embedded when its body changes.
+func (h *DocumentHandler) UpdateDocument(userId int64, partial bool, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	var req api.UpdateDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !partial && (req.Title == nil || req.Body == nil) {
+		http.Error(w, "Title and body are required", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.DB.GetDocument(id, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to get document", http.StatusInternalServerError)
+		return
+	}
+
+	updated := *doc
+	if req.Title != nil {
+		updated.Title = *req.Title
+	}
+	if req.URL != nil {
+		updated.URL = *req.URL
+	} else if !partial {
+		updated.URL = ""
+	}
+	if req.Body != nil {
+		updated.Body = *req.Body
+		updated.ContentHash = contentHash(updated.Body)
+	}
+	if req.Metadata != nil {
+		updated.Metadata = req.Metadata
+	} else if !partial {
+		updated.Metadata = nil
+	}
+
+	switch {
+	case updated.ContentHash != doc.ContentHash:
+		chunks, err := h.embedBody(updated.Body)
+		if err != nil {
+			writeIngestError(w, err)
+			return
+		}
+
+		err = h.DB.ReplaceDocument(updated, userId, chunks)
+		if errors.Is(err, db.ErrConflict) {
+			http.Error(w, "A document with the same content already exists in this dataset", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to update document", http.StatusInternalServerError)
+			return
+		}
+	case detailsChanged(*doc, updated):
+		err := h.DB.UpdateDocumentDetails(updated, userId)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to update document", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.GetDocument(userId, w, r)
+}
+
+func (h *DocumentHandler) DeleteDocument(userId int64, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.DeleteDocument(id, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toDocumentResponse(doc models.Document) api.DocumentResponse {
+	return api.DocumentResponse{
+		ID:         doc.ID,
+		Dataset:    doc.Dataset,
+		ExternalID: doc.ExternalID,
+		Title:      doc.Title,
+		URL:        doc.URL,
+		Body:       doc.Body,
+		Metadata:   doc.Metadata,
+		CreatedAt:  doc.CreatedAt,
+		UpdatedAt:  doc.UpdatedAt,
+	}
+}
+
+func writeIngestError(w http.ResponseWriter, err error) {
+	fmt.Println(err)
+
+	var ingestErr *IngestError
+	if errors.As(err, &ingestErr) {
+		http.Error(w, ingestErr.Message, ingestErr.Status)
+		return
+	}
+	http.Error(w, "Failed to add document", http.StatusInternalServerError)
 }
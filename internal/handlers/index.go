@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/indexes"
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+type IndexHandler struct {
+	DB *db.PostgresDB
+}
+
+// ListIndexes handles the /admin/indexes GET endpoint, reporting the vector
+// index of each of the user's datasets.
+func (h *IndexHandler) ListIndexes(userId int64, w http.ResponseWriter, r *http.Request) {
+	indexes, err := h.DB.VectorIndexes(userId)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to list indexes", http.StatusInternalServerError)
+		return
+	}
+
+	response := api.ListIndexesResponse{
+		Indexes: []api.IndexResponse{},
+	}
+	for _, index := range indexes {
+		response.Indexes = append(response.Indexes, toIndexResponse(index))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RebuildIndex handles the /admin/indexes/{dataset}/rebuild POST endpoint. The
+// index is rebuilt in the background and the response, sent right away, reports
+// it as rebuilding.
+func (h *IndexHandler) RebuildIndex(userId int64, w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("dataset")
+
+	dataset, err := h.DB.GetDataset(name, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to rebuild index", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.DB.StartVectorIndexRebuild(dataset.ID)
+	if errors.Is(err, db.ErrConflict) {
+		http.Error(w, "Index is already being rebuilt", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to rebuild index", http.StatusInternalServerError)
+		return
+	}
+
+	indexes, err := h.DB.VectorIndexes(userId)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to retrieve index", http.StatusInternalServerError)
+		return
+	}
+
+	for _, index := range indexes {
+		if index.Dataset == name {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(toIndexResponse(index))
+			return
+		}
+	}
+
+	http.Error(w, "Dataset not found", http.StatusNotFound)
+}
+
+func toIndexResponse(index models.VectorIndex) api.IndexResponse {
+	return api.IndexResponse{
+		Dataset:    index.Dataset,
+		Name:       index.Name,
+		Type:       index.Type,
+		Metric:     index.Metric,
+		Dimensions: index.Dimensions,
+		Chunks:     index.Chunks,
+		SizeBytes:  index.SizeBytes,
+		Status:     index.Status,
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+)
+
+type JobHandler struct {
+	DB *db.PostgresDB
+}
+
+func (h *JobHandler) GetJob(userId int64, w http.ResponseWriter, r *http.Request) {
+	job, err := h.DB.GetIngestionJob(r.PathValue("id"), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to get job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -1,22 +1,59 @@
 package handlers
 
 import (
+	"cmp"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	api "github.com/mrhollen/KnowledgeGPT/internal/api/query"
 	"github.com/mrhollen/KnowledgeGPT/internal/db"
 	"github.com/mrhollen/KnowledgeGPT/internal/llm"
+	"github.com/mrhollen/KnowledgeGPT/internal/mmr"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/mrhollen/KnowledgeGPT/internal/rerank"
+	"github.com/mrhollen/KnowledgeGPT/internal/snippet"
+	"github.com/mrhollen/KnowledgeGPT/internal/tokenizer"
+	"github.com/mrhollen/KnowledgeGPT/internal/verify"
+	"github.com/mrhollen/KnowledgeGPT/pkg/utils"
+)
+
+// searchResultsHeader starts the prompt sent with the search results
+const searchResultsHeader = "Search results: \n"
+
+// Limits on the snippets SimpleQuery returns for each result
+const (
+	maxSnippetLength = 1000
+	maxSnippetCount  = 10
 )
 
 type QueryHandler struct {
-	DB    *db.PostgresDB
-	LLM   llm.Client
-	Limit int
+	DB  *db.PostgresDB
+	LLM llm.Client
+	// Reranker is optional. When set, requests may ask for their candidates to
+	// be reranked before the prompt is built.
+	Reranker rerank.Reranker
+	// RerankCandidates is the number of candidates fetched for reranking
+	RerankCandidates int
+	// RerankTopK is the default number of reranked candidates kept
+	RerankTopK int
+	// MaxLimit caps the page size of SimpleQuery
+	MaxLimit int
+	// EfSearch and Probes are the default vector index search settings. Zero
+	// keeps the Postgres setting.
+	EfSearch int
+	Probes   int
+	// SessionHistory is the number of earlier messages of a session sent to
+	// the LLM with each question
+	SessionHistory int
+	// ClaimChecker checks cited claims against their documents for requests
+	// that ask for it
+	ClaimChecker *verify.ClaimChecker
 }
 
 func (h *QueryHandler) SimpleQuery(userId int64, w http.ResponseWriter, r *http.Request) {
@@ -24,7 +61,6 @@ func (h *QueryHandler) SimpleQuery(userId int64, w http.ResponseWriter, r *http.
 
 	queryString := query.Get("query")
 	limit := query.Get("limit")
-	dataset := query.Get("dataset")
 
 	limitNum := 5
 
@@ -32,30 +68,142 @@ func (h *QueryHandler) SimpleQuery(userId int64, w http.ResponseWriter, r *http.
 		http.Error(w, "No query", http.StatusBadRequest)
 		return
 	}
-	if dataset == "" {
-		dataset = "default"
-	}
 	if limit != "" {
 		var err error
 		limitNum, err = strconv.Atoi(limit)
-		if err != nil {
+		if err != nil || limitNum < 1 {
 			limitNum = 5
 		}
 	}
+	if h.MaxLimit > 0 {
+		limitNum = min(limitNum, h.MaxLimit)
+	}
+
+	// A cursor from a previous page takes precedence over an explicit offset
+	offset := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		if offset, err = decodeCursor(cursor); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	} else if value := query.Get("offset"); value != "" {
+		var err error
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if offset+limitNum > db.MaxSearchDepth {
+		http.Error(w, fmt.Sprintf("Results beyond the first %d cannot be requested", db.MaxSearchDepth), http.StatusBadRequest)
+		return
+	}
+
+	// Datasets may be given as repeated or comma-separated parameters
+	var datasets []string
+	for _, dataset := range query["dataset"] {
+		datasets = append(datasets, strings.Split(dataset, ",")...)
+	}
 
 	request := api.SimpleQueryRequest{
-		Query:   queryString,
-		Limit:   limitNum,
-		Dataset: dataset,
+		Query:    queryString,
+		Limit:    limitNum,
+		Offset:   offset,
+		Datasets: datasetNames(datasets),
+		Mode:     query.Get("mode"),
+	}
+
+	if err := db.ValidateSearchMode(request.Mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if minScore := query.Get("min_score"); minScore != "" {
+		value, err := strconv.ParseFloat(minScore, 64)
+		if err != nil {
+			http.Error(w, "min_score must be a number", http.StatusBadRequest)
+			return
+		}
+		request.MinScore = &value
 	}
 
-	queryVector, err := h.LLM.GetEmbedding(request.Query, "")
+	if useMMR, _ := strconv.ParseBool(query.Get("mmr")); useMMR {
+		lambda := mmr.DefaultLambda
+		if value := query.Get("lambda"); value != "" {
+			var err error
+			if lambda, err = strconv.ParseFloat(value, 64); err != nil || lambda < 0 || lambda > 1 {
+				http.Error(w, "lambda must be a number between 0 and 1", http.StatusBadRequest)
+				return
+			}
+		}
+		request.Lambda = &lambda
+	}
+
+	var err error
+	if request.EfSearch, err = positiveIntParam(query.Get("ef_search")); err != nil {
+		http.Error(w, "ef_search must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if request.Probes, err = positiveIntParam(query.Get("probes")); err != nil {
+		http.Error(w, "probes must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	request.Snippets, _ = strconv.ParseBool(query.Get("snippets"))
+	if request.SnippetLength, err = positiveIntParam(query.Get("snippet_length")); err != nil {
+		http.Error(w, "snippet_length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if request.SnippetCount, err = positiveIntParam(query.Get("snippet_count")); err != nil {
+		http.Error(w, "snippet_count must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	request.SnippetLength = min(cmp.Or(request.SnippetLength, snippet.DefaultLength), maxSnippetLength)
+	request.SnippetCount = min(cmp.Or(request.SnippetCount, 1), maxSnippetCount)
+	if includeText, err := strconv.ParseBool(query.Get("include_text")); err == nil {
+		request.OmitText = !includeText
+	}
+
+	if filters := query.Get("filters"); filters != "" {
+		if err := json.Unmarshal([]byte(filters), &request.Filters); err != nil {
+			http.Error(w, "Invalid filters", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := db.ValidateMetadataFilters(request.Filters); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filters: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	searchQuery := db.SearchQuery{
+		Text:      request.Query,
+		Mode:      request.Mode,
+		Datasets:  request.Datasets,
+		UserID:    userId,
+		Filters:   request.Filters,
+		MinScore:  request.MinScore,
+		EfSearch:  cmp.Or(request.EfSearch, h.EfSearch),
+		Probes:    cmp.Or(request.Probes, h.Probes),
+		MMRLambda: request.Lambda,
+	}
+
+	if searchQuery.NeedsVector() {
+		var err error
+		searchQuery.Vector, err = h.LLM.GetEmbedding(request.Query, "")
+		if err != nil {
+			http.Error(w, "Could not generate query embedding", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	docs, more, err := h.DB.SimpleSearchDocuments(searchQuery, request.Offset, request.Limit)
 	if err != nil {
-		http.Error(w, "Could not generate query embedding", http.StatusInternalServerError)
+		fmt.Println(err)
+		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
 		return
 	}
 
-	docs, err := h.DB.SimpleSearchDocuments(queryVector, request.Dataset, userId, request.Limit)
+	total, err := h.DB.CountSearchCandidates(searchQuery)
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
@@ -63,18 +211,29 @@ func (h *QueryHandler) SimpleQuery(userId int64, w http.ResponseWriter, r *http.
 	}
 
 	response := api.SimpleQueryResponse{
-		Responses: []api.SimpleQueryResponseContent{},
+		Responses:       []api.SimpleQueryResponseContent{},
+		TotalCandidates: total,
+	}
+	if more {
+		response.NextCursor = encodeCursor(request.Offset + request.Limit)
 	}
 
 	for _, doc := range docs {
-		response.Responses = append(
-			response.Responses,
-			api.SimpleQueryResponseContent{
-				Title: doc.Title,
-				URL:   doc.URL,
-				Text:  doc.Body,
-			},
-		)
+		content := api.SimpleQueryResponseContent{
+			Dataset:  doc.Dataset,
+			Title:    doc.Title,
+			URL:      doc.URL,
+			Metadata: doc.Metadata,
+			Score:    doc.Score,
+		}
+		if !request.OmitText {
+			content.Text = doc.Body
+		}
+		if request.Snippets {
+			content.Snippets = toSnippets(snippet.Extract(doc.Body, request.Query, request.SnippetLength, request.SnippetCount))
+		}
+
+		response.Responses = append(response.Responses, content)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -92,29 +251,152 @@ func (h *QueryHandler) QueryWithLLM(userId int64, w http.ResponseWriter, r *http
 		http.Error(w, "Query cannot be empty", http.StatusBadRequest)
 		return
 	}
+	if err := db.ValidateMetadataFilters(req.Filters); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filters: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := db.ValidateSearchMode(req.Mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.EfSearch < 0 || req.Probes < 0 {
+		http.Error(w, "ef_search and probes must be positive integers", http.StatusBadRequest)
+		return
+	}
+	if req.Lambda != nil && (*req.Lambda < 0 || *req.Lambda > 1) {
+		http.Error(w, "lambda must be a number between 0 and 1", http.StatusBadRequest)
+		return
+	}
+	if err := db.ValidateHyDEMode(req.HyDE); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Format != "" && req.Format != api.FormatText && req.Format != api.FormatMarkdown {
+		http.Error(w, fmt.Sprintf("Unknown format: %s", req.Format), http.StatusBadRequest)
+		return
+	}
+	if req.Rerank && h.Reranker == nil {
+		http.Error(w, "Reranking is not configured", http.StatusBadRequest)
+		return
+	}
+	if req.RerankTopK != nil && *req.RerankTopK < 1 {
+		http.Error(w, "rerank_top_k must be a positive integer", http.StatusBadRequest)
+		return
+	}
 
-	queryVector, err := h.LLM.GetEmbedding(req.Query, req.Model)
-	if err != nil {
-		http.Error(w, "Could not generate query embedding", http.StatusInternalServerError)
+	// Continue the requested session, or start a new one
+	session := &models.ChatSession{}
+	if req.SessionID != "" {
+		var err error
+		session, err = h.DB.GetSession(req.SessionID, userId)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to load session", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var err error
+		session.ID, err = utils.GenerateUUID()
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
 	}
+	history := sessionHistory(session.Messages, h.SessionHistory)
 
-	limit := h.Limit
-	if req.Limit != nil {
-		limit = *req.Limit
+	searchQuery := db.SearchQuery{
+		Text:     req.Query,
+		Mode:     req.Mode,
+		Datasets: datasetNames(append(req.Datasets, req.Dataset)),
+		UserID:   userId,
+		Filters:  req.Filters,
+		MinScore: req.MinScore,
+		EfSearch: cmp.Or(req.EfSearch, h.EfSearch),
+		Probes:   cmp.Or(req.Probes, h.Probes),
+	}
+	if req.MMR {
+		lambda := mmr.DefaultLambda
+		if req.Lambda != nil {
+			lambda = *req.Lambda
+		}
+		searchQuery.MMRLambda = &lambda
+	}
+
+	var searchQueries []string
+	if req.Rewrite {
+		var err error
+		searchQueries, err = h.rewriteQuery(req, history)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to rewrite query", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(searchQueries) == 0 {
+		searchQueries = []string{req.Query}
+	}
+
+	var vectors [][]float32
+	var hypotheticalAnswers []string
+	if searchQuery.NeedsVector() {
+		var err error
+		hydeMode := req.HyDE
+		if hydeMode == "" {
+			hydeMode, err = h.DB.DefaultHyDEMode(searchQuery.Datasets, userId)
+			if err != nil {
+				fmt.Println(err)
+				http.Error(w, "Failed to search documents", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		vectors, hypotheticalAnswers, err = h.embedQueries(searchQueries, hydeMode, req.Model)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Could not generate query embedding", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	candidateCount := 100
+	// Only the retrieved candidates can be kept, and fetching more than
+	// configured would make every query as expensive as the client asks
+	topK := h.RerankTopK
+	if req.RerankTopK != nil {
+		topK = min(*req.RerankTopK, h.RerankCandidates)
 	}
-	datasetName := req.Dataset
-	if datasetName == "" {
-		datasetName = "default"
+	if req.Rerank {
+		candidateCount = max(h.RerankCandidates, topK)
 	}
 
-	docs, err := h.DB.SearchDocuments(queryVector, datasetName, userId, limit)
+	docs, err := h.searchAll(searchQuery, searchQueries, vectors, candidateCount)
+	if err == nil && req.Rerank {
+		docs, err = h.rerank(req.Query, docs, topK)
+	}
+	if err == nil && searchQuery.MMRLambda != nil {
+		// Diversify before the context budget is filled so near-duplicates
+		// do not crowd out other sources
+		docs = mmr.Rerank(docs, *searchQuery.MMRLambda, 0)
+	}
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
 		return
 	}
 
-	prompt := "Search results: \n"
+	// Fill what is left of the model's context window with search results
+	budget := h.LLM.ContextBudget(searchResultsHeader+req.Query, history, req.Model)
+	if req.Limit != nil {
+		budget = min(budget, *req.Limit)
+	}
+	docs = fitContextBudget(docs, budget)
+
+	prompt := searchResultsHeader
 	if len(docs) < 1 {
 		prompt += "No results \n\n"
 	}
@@ -130,35 +412,312 @@ func (h *QueryHandler) QueryWithLLM(userId int64, w http.ResponseWriter, r *http
 	}
 	prompt += req.Query
 
-	response, err := h.LLM.SendPrompt(prompt, req.Model)
+	renderer := newCitationRenderer(docs, req.Format)
+
+	if req.Stream {
+		events := newEventStream(w)
+
+		answer, err := h.streamAnswer(r.Context(), events, prompt, history, req.Model, renderer)
+		if err != nil {
+			fmt.Println(err)
+			events.Send("error", api.StreamError{Error: "Failed to get response from LLM"})
+			return
+		}
+		if err := h.saveTurn(userId, session.ID, req, answer, docs); err != nil {
+			fmt.Println(err)
+			events.Send("error", api.StreamError{Error: "Failed to save session"})
+			return
+		}
+
+		done := api.StreamDone{
+			SessionID:           session.ID,
+			Sources:             renderer.Sources(req.Query),
+			HypotheticalAnswers: hypotheticalAnswers,
+		}
+		if req.Rewrite {
+			done.SearchQueries = searchQueries
+		}
+		if req.Verify || req.VerifyClaims {
+			done.Verification = h.verifyAnswer(answer, docs, renderer, req.VerifyClaims, req.Model)
+		}
+		events.Send("done", done)
+		return
+	}
+
+	response, err := h.LLM.SendPrompt(prompt, history, req.Model)
 	if err != nil {
 		http.Error(w, "Failed to get response from LLM", http.StatusInternalServerError)
 		return
 	}
 
-	re := regexp.MustCompile(`\[citation\](\d+)\[/citation\]`)
-	replacedText := re.ReplaceAllStringFunc(response, func(match string) string {
-		submatches := re.FindStringSubmatch(match)
-		if len(submatches) != 2 {
-			return match
+	if err := h.saveTurn(userId, session.ID, req, response, docs); err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+
+	text, citations := renderer.Render(response)
+	res := api.QueryResponse{
+		Response:  text,
+		Sources:   renderer.Sources(req.Query),
+		Citations: citations,
+		SessionID: session.ID,
+	}
+	if req.Rewrite {
+		res.SearchQueries = searchQueries
+	}
+	res.HypotheticalAnswers = hypotheticalAnswers
+	if req.Verify || req.VerifyClaims {
+		res.Verification = h.verifyAnswer(response, docs, renderer, req.VerifyClaims, req.Model)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// encodeCursor returns an opaque cursor for the page starting at offset.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset of the page a cursor points to.
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	value, found := strings.CutPrefix(string(data), "offset:")
+	if !found {
+		return 0, errors.New("unknown cursor format")
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor offset")
+	}
+	return offset, nil
+}
+
+func toSnippets(snippets []snippet.Snippet) []api.Snippet {
+	results := make([]api.Snippet, 0, len(snippets))
+	for _, s := range snippets {
+		highlights := make([]api.Highlight, 0, len(s.Highlights))
+		for _, highlight := range s.Highlights {
+			highlights = append(highlights, api.Highlight{Start: highlight.Start, End: highlight.End})
 		}
 
-		var id int64
-		fmt.Sscanf(submatches[1], "%d", &id)
+		results = append(results, api.Snippet{
+			Offset:     s.Offset,
+			Text:       s.Text,
+			Highlights: highlights,
+			Fragment:   s.Fragment,
+		})
+	}
+	return results
+}
 
-		for _, doc := range docs {
-			if doc.ID == id {
-				return fmt.Sprintf("[%s](%s)", doc.Title, doc.URL)
-			}
+// positiveIntParam parses an optional positive integer query parameter,
+// returning zero when it is absent.
+func positiveIntParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if parsed < 1 {
+		return 0, errors.New("value must be positive")
+	}
+	return parsed, nil
+}
+
+// fitContextBudget returns the leading results whose combined size in the
+// prompt does not exceed budget tokens.
+func fitContextBudget(results []models.SearchResult, budget int) []models.SearchResult {
+	fitted := []models.SearchResult{}
+	used := 0
+	for _, result := range results {
+		used += promptTokens(result)
+		if used > budget {
+			break
 		}
+		fitted = append(fitted, result)
+	}
+
+	return fitted
+}
 
-		return match
-	})
+// promptTokens returns the number of tokens a search result takes up in the
+// prompt. The body's token count is stored at ingest, so only the much shorter
+// remainder is tokenized here.
+func promptTokens(result models.SearchResult) int {
+	result.Body = ""
 
-	res := api.QueryResponse{
-		Response: strings.ReplaceAll(replacedText, "\\n", "\n"),
+	docJson, err := json.Marshal(result)
+	if err != nil {
+		return result.TokenCount
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
+	return result.TokenCount + tokenizer.Count(fmt.Sprintf("```json\n%s\n```\n\n", docJson))
+}
+
+// datasetNames trims and deduplicates the requested dataset names, defaulting
+// to the default dataset when none are given.
+func datasetNames(names []string) []string {
+	datasets := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(datasets, name) {
+			datasets = append(datasets, name)
+		}
+	}
+
+	if len(datasets) == 0 {
+		return []string{"default"}
+	}
+	return datasets
+}
+
+// sessionHistory returns the last count messages of a session as the earlier
+// turns of the conversation.
+func sessionHistory(messages []models.ChatMessage, count int) []llm.Message {
+	messages = messages[len(messages)-min(max(count, 0), len(messages)):]
+
+	history := make([]llm.Message, 0, len(messages))
+	for _, message := range messages {
+		history = append(history, llm.Message{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	return history
+}
+
+// saveTurn adds the request's question and the answer to the session, along
+// with the IDs of the documents the answer was based on.
+func (h *QueryHandler) saveTurn(userId int64, sessionId string, req api.QueryRequest, answer string, docs []models.SearchResult) error {
+	documentIds := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		if !slices.Contains(documentIds, doc.ID) {
+			documentIds = append(documentIds, doc.ID)
+		}
+	}
+
+	return h.DB.AppendSessionMessages(sessionId, userId, req.Model,
+		models.ChatMessage{Role: llm.RoleUser, Content: req.Query},
+		models.ChatMessage{Role: llm.RoleAssistant, Content: answer, DocumentIDs: documentIds},
+	)
+}
+
+// rewriteQuery asks the LLM for standalone search queries for the request's
+// question, taking the earlier turns of the conversation into account.
+func (h *QueryHandler) rewriteQuery(req api.QueryRequest, history []llm.Message) ([]string, error) {
+	lines := make([]string, 0, len(history))
+	for _, message := range history {
+		lines = append(lines, message.Role+": "+message.Content)
+	}
+
+	count := 3
+	if req.RewriteCount != nil {
+		count = *req.RewriteCount
+	}
+
+	return h.LLM.GetSearchWords(req.Query, lines, count, req.Model)
+}
+
+// embedQueries embeds the search queries for vector search. With HyDE the
+// LLM's hypothetical answer to each query is embedded instead, or averaged with
+// the query's own embedding, and the answers are returned as well.
+func (h *QueryHandler) embedQueries(queries []string, hydeMode string, model string) ([][]float32, []string, error) {
+	if hydeMode == db.HyDEOff {
+		vectors, err := h.LLM.GetEmbeddings(queries, model)
+		return vectors, nil, err
+	}
+
+	answers := make([]string, len(queries))
+	for i, query := range queries {
+		answer, err := h.LLM.GetHypotheticalAnswer(query, model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get hypothetical answer: %w", err)
+		}
+		// Fall back to the query rather than embedding nothing
+		answers[i] = cmp.Or(answer, query)
+	}
+
+	inputs := answers
+	if hydeMode == db.HyDEAverage {
+		inputs = append(slices.Clone(answers), queries...)
+	}
+
+	embeddings, err := h.LLM.GetEmbeddings(inputs, model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vectors := embeddings[:len(queries)]
+	if hydeMode == db.HyDEAverage {
+		for i := range vectors {
+			vectors[i] = averageVectors(embeddings[i], embeddings[len(queries)+i])
+		}
+	}
+
+	return vectors, answers, nil
+}
+
+// averageVectors returns the element-wise mean of two vectors of the same
+// length.
+func averageVectors(a []float32, b []float32) []float32 {
+	average := make([]float32, len(a))
+	for i := range a {
+		average[i] = (a[i] + b[i]) / 2
+	}
+	return average
+}
+
+// searchAll runs q once for each of texts, with the matching vector when the
+// mode needs one, and fuses the rankings into a single deduplicated list.
+func (h *QueryHandler) searchAll(q db.SearchQuery, texts []string, vectors [][]float32, limit int) ([]models.SearchResult, error) {
+	rankings := make([][]models.SearchResult, 0, len(texts))
+	for i, text := range texts {
+		q.Text = text
+		if q.NeedsVector() {
+			q.Vector = vectors[i]
+		}
+
+		results, err := h.DB.SearchChunks(q, limit)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, results)
+	}
+
+	if len(rankings) == 1 {
+		return rankings[0], nil
+	}
+	return db.FuseRankings(limit, rankings...), nil
+}
+
+// rerank reorders candidates with the reranker and keeps the best topK.
+func (h *QueryHandler) rerank(query string, candidates []models.SearchResult, topK int) ([]models.SearchResult, error) {
+	bodies := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		bodies[i] = candidate.Title + "\n\n" + candidate.Body
+	}
+
+	ranked, err := h.Reranker.Rerank(query, bodies, topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank candidates: %w", err)
+	}
+
+	results := make([]models.SearchResult, 0, len(ranked))
+	for _, result := range ranked {
+		candidate := candidates[result.Index]
+		candidate.Score = result.Score
+		results = append(results, candidate)
+	}
+
+	return results, nil
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/query"
+	"github.com/mrhollen/KnowledgeGPT/internal/llm"
+	"github.com/mrhollen/KnowledgeGPT/internal/verify"
+)
+
+// eventStream writes server-sent events to a response.
+type eventStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+// newEventStream starts a response of server-sent events.
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	return &eventStream{w: w, controller: http.NewResponseController(w)}
+}
+
+// Send writes an event with data encoded as JSON and flushes it to the client.
+func (s *eventStream) Send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+// streamAnswer sends the LLM's answer to prompt as a "token" event for each
+// piece of text, with its citations rendered, and returns the whole answer.
+func (h *QueryHandler) streamAnswer(ctx context.Context, events *eventStream, prompt string, history []llm.Message, model string, renderer *citationRenderer) (string, error) {
+	citations := &citationStream{renderer: renderer}
+	answer, err := h.LLM.StreamPrompt(ctx, prompt, history, model, func(token string) error {
+		if text, cited := citations.Next(token); text != "" {
+			return events.Send("token", api.StreamToken{Text: text, Citations: cited})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if text, cited := citations.Flush(); text != "" {
+		if err := events.Send("token", api.StreamToken{Text: text, Citations: cited}); err != nil {
+			return "", err
+		}
+	}
+
+	return answer, nil
+}
+
+// citationStream resolves the citations of an answer that arrives in pieces.
+// Text that may be the start of a citation marker is held back until the
+// marker is complete.
+type citationStream struct {
+	renderer *citationRenderer
+	pending  string
+}
+
+// Next adds a piece of the answer and returns the text that is ready to send,
+// with the citations in it.
+func (c *citationStream) Next(token string) (string, []api.Citation) {
+	c.pending += token
+
+	cut := len(c.pending)
+	for i := 0; i < len(c.pending); i++ {
+		if c.pending[i] == '[' && isPartialCitation(c.pending[i:]) {
+			cut = i
+			break
+		}
+	}
+	// An escaped newline may be split after its backslash
+	if cut == len(c.pending) && strings.HasSuffix(c.pending, `\`) {
+		cut--
+	}
+
+	text := c.pending[:cut]
+	c.pending = c.pending[cut:]
+	return c.renderer.Render(text)
+}
+
+// Flush returns the text still held back once the answer is complete.
+func (c *citationStream) Flush() (string, []api.Citation) {
+	text := c.pending
+	c.pending = ""
+	return c.renderer.Render(text)
+}
+
+// isPartialCitation reports whether text is the start of a citation marker
+// that has not been completed yet.
+func isPartialCitation(text string) bool {
+	if len(text) <= len(verify.CitationOpen) {
+		return strings.HasPrefix(verify.CitationOpen, text)
+	}
+
+	rest, found := strings.CutPrefix(text, verify.CitationOpen)
+	if !found {
+		return false
+	}
+	rest = strings.TrimLeft(rest, "0123456789")
+
+	return len(rest) < len(verify.CitationClose) && strings.HasPrefix(verify.CitationClose, rest)
+}
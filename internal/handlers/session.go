@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	queryapi "github.com/mrhollen/KnowledgeGPT/internal/api/query"
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/sessions"
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+type SessionHandler struct {
+	DB *db.PostgresDB
+}
+
+func (h *SessionHandler) ListSessions(userId int64, w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.DB.ListSessions(userId)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response := api.ListSessionsResponse{
+		Sessions: []api.SessionResponse{},
+	}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, toSessionResponse(session))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSession returns the transcript of a session, with the documents each
+// answer was based on.
+func (h *SessionHandler) GetSession(userId int64, w http.ResponseWriter, r *http.Request) {
+	h.writeSession(userId, r.PathValue("id"), w)
+}
+
+func (h *SessionHandler) UpdateSession(userId int64, w http.ResponseWriter, r *http.Request) {
+	var req api.UpdateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			http.Error(w, "Session title cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		err := h.DB.RenameSession(id, userId, title)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Failed to update session", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.writeSession(userId, id, w)
+}
+
+func (h *SessionHandler) DeleteSession(userId int64, w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteSession(r.PathValue("id"), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SessionHandler) writeSession(userId int64, id string, w http.ResponseWriter) {
+	session, err := h.DB.GetSession(id, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to get session", http.StatusInternalServerError)
+		return
+	}
+
+	var documentIds []int64
+	for _, message := range session.Messages {
+		documentIds = append(documentIds, message.DocumentIDs...)
+	}
+
+	documents, err := h.DB.GetDocumentsByID(documentIds, userId)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Failed to get session", http.StatusInternalServerError)
+		return
+	}
+
+	byId := map[int64]models.Document{}
+	for _, document := range documents {
+		byId[document.ID] = document
+	}
+
+	response := toSessionResponse(*session)
+	response.Messages = []api.MessageResponse{}
+	for _, message := range session.Messages {
+		response.Messages = append(response.Messages, toMessageResponse(message, byId))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func toSessionResponse(session models.ChatSession) api.SessionResponse {
+	return api.SessionResponse{
+		ID:        session.ID,
+		Title:     session.Title,
+		Model:     session.Model,
+		TurnCount: session.TurnCount,
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+	}
+}
+
+// toMessageResponse resolves the citations of a message against the documents
+// it was based on.
+func toMessageResponse(message models.ChatMessage, documents map[int64]models.Document) api.MessageResponse {
+	var sources []models.SearchResult
+	response := api.MessageResponse{
+		Role:      message.Role,
+		CreatedAt: message.CreatedAt,
+	}
+
+	for _, id := range message.DocumentIDs {
+		document, ok := documents[id]
+		if !ok {
+			continue
+		}
+
+		sources = append(sources, models.SearchResult{Document: document})
+		response.Sources = append(response.Sources, api.SourceResponse{
+			ID:      document.ID,
+			Dataset: document.Dataset,
+			Title:   document.Title,
+			URL:     document.URL,
+		})
+	}
+	response.Content, _ = newCitationRenderer(sources, queryapi.FormatMarkdown).Render(message.Content)
+
+	return response
+}
@@ -2,17 +2,25 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
 
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/documents"
 	"github.com/mrhollen/KnowledgeGPT/internal/parsing"
 )
 
-type UploadHandler struct{}
+type UploadHandler struct {
+	Documents *DocumentHandler
+	Parsers   *parsing.Registry
+}
 
-// uploadHandler handles the /upload POST endpoint
+// UploadFile handles the /upload POST endpoint. The uploaded file is stored as a
+// document unless extract_only is set, in which case only its text is returned.
 func (u *UploadHandler) UploadFile(userId int64, w http.ResponseWriter, r *http.Request) {
 	// Explicitly set the maximum upload size to 10MB
 	const MaxUploadSize = 10 * 1024 * 1024 // 10 MB
@@ -44,13 +52,6 @@ func (u *UploadHandler) UploadFile(userId int64, w http.ResponseWriter, r *http.
 	}
 	defer file.Close()
 
-	// Check the file extension
-	if !parsing.IsPDF(header.Filename) {
-		log.Printf("Invalid file type uploaded: %s", header.Filename)
-		http.Error(w, "Please upload a PDF file", http.StatusBadRequest)
-		return
-	}
-
 	// Read the file into a buffer
 	var buf bytes.Buffer
 	n, err := io.Copy(&buf, file)
@@ -61,19 +62,71 @@ func (u *UploadHandler) UploadFile(userId int64, w http.ResponseWriter, r *http.
 	}
 	log.Printf("Uploaded file size: %d bytes", n)
 
-	// Extract text from PDF using the pdfparser package
-	text, err := parsing.ExtractTextFromPDF(buf.Bytes())
+	// Extract text with the parser registered for the file's sniffed type
+	text, mimeType, err := u.Parsers.Parse(header.Filename, buf.Bytes())
+	if errors.Is(err, parsing.ErrUnsupportedType) {
+		log.Printf("Invalid file type uploaded: %s (%s)", header.Filename, mimeType)
+		http.Error(w, fmt.Sprintf("Unsupported file type: %s", mimeType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if errors.Is(err, parsing.ErrInvalidContent) {
+		log.Printf("Invalid file uploaded: %s (%s): %v", header.Filename, mimeType, err)
+		http.Error(w, fmt.Sprintf("Could not extract text from file, it is not a valid %s file", mimeType), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		log.Printf("Error extracting text: %v", err)
-		http.Error(w, "Failed to extract text from PDF", http.StatusInternalServerError)
+		http.Error(w, "Failed to extract text from file", http.StatusInternalServerError)
+		return
+	}
+
+	// Only return the extracted text when explicitly asked to
+	extractOnly, _ := strconv.ParseBool(r.FormValue("extract_only"))
+	if extractOnly {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write([]byte(text))
+		if err != nil {
+			log.Printf("Error writing response: %v", err)
+		}
 		return
 	}
 
-	// Return the extracted text
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(text))
+	// Default the title to the uploaded file name
+	title := r.FormValue("title")
+	if title == "" {
+		title = header.Filename
+	}
+
+	req := api.AddDocumentRequest{
+		Title:      title,
+		URL:        r.FormValue("url"),
+		Body:       text,
+		Dataset:    r.FormValue("dataset"),
+		ExternalID: r.FormValue("external_id"),
+	}
+
+	if metadata := r.FormValue("metadata"); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &req.Metadata); err != nil {
+			http.Error(w, "Metadata must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := u.Documents.Ingest(userId, req)
 	if err != nil {
+		writeIngestError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if response.Status == api.StatusCreated {
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error writing response: %v", err)
 	}
 }
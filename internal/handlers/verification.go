@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"strings"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/query"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/mrhollen/KnowledgeGPT/internal/verify"
+)
+
+// maxClaimChecks caps the number of claims checked for an answer, since each
+// check is a request to the LLM
+const maxClaimChecks = 20
+
+// verifyAnswer reports which sentences of answer cite documents that were not
+// given to the LLM and which make a claim without citing any. With
+// checkClaims, the LLM is also asked whether each cited document supports the
+// sentence citing it.
+func (h *QueryHandler) verifyAnswer(answer string, docs []models.SearchResult, renderer *citationRenderer, checkClaims bool, model string) *api.Verification {
+	report := &api.Verification{
+		UncitedSentences: []string{},
+		UnknownCitations: []api.UnknownCitation{},
+	}
+
+	// A document given as several chunks is checked against all of them
+	texts := map[int64][]string{}
+	for _, doc := range docs {
+		texts[doc.ID] = append(texts[doc.ID], doc.Body)
+	}
+
+	var claims []verify.Claim
+	var checks []api.ClaimCheck
+	for _, sentence := range verify.Sentences(answer) {
+		if sentence.NeedsCitation() {
+			report.Sentences++
+			if len(sentence.DocumentIDs) == 0 {
+				report.UncitedSentences = append(report.UncitedSentences, sentence.Text)
+			} else {
+				report.CitedSentences++
+			}
+		}
+
+		for _, id := range sentence.DocumentIDs {
+			index := renderer.sourceIndex(id)
+			if index < 0 {
+				report.UnknownCitations = append(report.UnknownCitations, api.UnknownCitation{
+					DocumentID: id,
+					Sentence:   sentence.Text,
+				})
+				continue
+			}
+
+			if !checkClaims {
+				continue
+			}
+			if len(claims) == maxClaimChecks {
+				report.ClaimsSkipped++
+				continue
+			}
+			claims = append(claims, verify.Claim{
+				Sentence:      sentence.Text,
+				DocumentTitle: renderer.sources[index].Title,
+				DocumentText:  strings.Join(texts[id], "\n\n"),
+			})
+			checks = append(checks, api.ClaimCheck{Sentence: sentence.Text, Source: index})
+		}
+	}
+
+	report.Verified = len(report.UncitedSentences) == 0 && len(report.UnknownCitations) == 0
+	if !checkClaims {
+		return report
+	}
+
+	// Claims that were skipped or got no verdict were not shown to be supported
+	report.Verified = report.Verified && report.ClaimsSkipped == 0
+	report.Claims = []api.ClaimCheck{}
+	for i, verdict := range h.ClaimChecker.Check(claims, model) {
+		checks[i].Verdict = verdict.Result
+		checks[i].Explanation = verdict.Explanation
+		report.Claims = append(report.Claims, checks[i])
+		report.Verified = report.Verified && verdict.Result == verify.VerdictSupported
+	}
+
+	return report
+}
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	api "github.com/mrhollen/KnowledgeGPT/internal/api/documents"
+	"github.com/mrhollen/KnowledgeGPT/internal/db"
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+	"github.com/mrhollen/KnowledgeGPT/pkg/utils"
+)
+
+// IngestFunc stores a batch of documents, returning a response or an error for
+// each request in order.
+type IngestFunc func(userId int64, reqs []api.AddDocumentRequest) ([]api.AddDocumentResponse, []error)
+
+// temporary is implemented by ingest errors that know whether trying again may
+// succeed. Errors that do not implement it are assumed to be temporary.
+type temporary interface {
+	Temporary() bool
+}
+
+// Worker processes queued ingestion jobs in the background. Jobs are persisted
+// in Postgres, so several servers can share them and work left over when a
+// server stops is resumed once its lease expires.
+type Worker struct {
+	DB          *db.PostgresDB
+	Ingest      IngestFunc
+	Concurrency int
+	// BatchSize is the number of items claimed and ingested together
+	BatchSize    int
+	PollInterval time.Duration
+	// Lease is how long a claimed batch may take before it is considered
+	// abandoned and claimed again
+	Lease time.Duration
+	// MaxAttempts is the number of times an item failing with a temporary
+	// error is tried before it is marked as failed
+	MaxAttempts int
+	// RetryDelay is how long a requeued item waits, multiplied by the number
+	// of attempts made so far
+	RetryDelay time.Duration
+	wake       chan struct{}
+}
+
+func NewWorker(database *db.PostgresDB, ingest IngestFunc, concurrency int) *Worker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Worker{
+		DB:           database,
+		Ingest:       ingest,
+		Concurrency:  concurrency,
+		BatchSize:    16,
+		PollInterval: 10 * time.Second,
+		Lease:        15 * time.Minute,
+		MaxAttempts:  5,
+		RetryDelay:   time.Minute,
+		wake:         make(chan struct{}, concurrency),
+	}
+}
+
+// Start launches the worker goroutines.
+func (w *Worker) Start(ctx context.Context) error {
+	for i := 0; i < w.Concurrency; i++ {
+		go w.run(ctx)
+	}
+
+	return nil
+}
+
+// Enqueue stores a new job for the documents and returns its ID.
+func (w *Worker) Enqueue(userId int64, reqs []api.AddDocumentRequest) (string, error) {
+	id, err := utils.GenerateUUID()
+	if err != nil {
+		return "", fmt.Errorf("could not generate job id: %w", err)
+	}
+
+	payloads := make([][]byte, len(reqs))
+	for i, req := range reqs {
+		payloads[i], err = json.Marshal(req)
+		if err != nil {
+			return "", fmt.Errorf("could not encode job item %d: %w", i, err)
+		}
+	}
+
+	if err := w.DB.CreateIngestionJob(id, userId, payloads); err != nil {
+		return "", err
+	}
+
+	w.notify()
+	return id, nil
+}
+
+// notify wakes idle workers without blocking when they are all busy.
+func (w *Worker) notify() {
+	for i := 0; i < w.Concurrency; i++ {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	for {
+		items, err := w.DB.ClaimIngestionJobItems(w.BatchSize, w.Lease)
+		if err != nil {
+			log.Printf("Error claiming ingestion job items: %v", err)
+		}
+
+		if len(items) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.wake:
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+
+		w.process(items)
+	}
+}
+
+// process ingests a batch of claimed items. Items may come from several jobs,
+// so they are ingested separately for each user.
+func (w *Worker) process(items []models.IngestionJobItem) {
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && items[end].UserID == items[start].UserID {
+			end++
+		}
+
+		w.processUser(items[start:end])
+		start = end
+	}
+}
+
+// processUser ingests a batch of claimed items that belong to the same user.
+// Items failing with a temporary error are requeued until they run out of
+// attempts; other failures are final.
+func (w *Worker) processUser(items []models.IngestionJobItem) {
+	errorMessages := make([]string, len(items))
+	documentIds := make([]int64, len(items))
+	retry := make([]bool, len(items))
+
+	var reqs []api.AddDocumentRequest
+	var positions []int
+	for i, item := range items {
+		var req api.AddDocumentRequest
+		if err := json.Unmarshal(item.Payload, &req); err != nil {
+			errorMessages[i] = fmt.Sprintf("invalid document payload: %v", err)
+			continue
+		}
+
+		reqs = append(reqs, req)
+		positions = append(positions, i)
+	}
+
+	if len(reqs) > 0 {
+		responses, errs := w.Ingest(items[0].UserID, reqs)
+		for j, i := range positions {
+			documentIds[i] = responses[j].ID
+			if errs[j] != nil {
+				errorMessages[i] = errs[j].Error()
+
+				var t temporary
+				retry[i] = (!errors.As(errs[j], &t) || t.Temporary()) && items[i].Attempts < w.MaxAttempts
+			}
+		}
+	}
+
+	for i, item := range items {
+		var err error
+		if retry[i] {
+			delay := w.RetryDelay * time.Duration(item.Attempts)
+			err = w.DB.RequeueIngestionJobItem(item, delay, errorMessages[i])
+		} else {
+			err = w.DB.FinishIngestionJobItem(item, documentIds[i], errorMessages[i])
+		}
+
+		// The lease ran out and another worker took the item over, so its
+		// outcome is the one that counts
+		if errors.Is(err, db.ErrNotFound) {
+			log.Printf("Dropping the result of item %d of job %s, whose lease expired", item.Index, item.JobID)
+		} else if err != nil {
+			log.Printf("Error finishing item %d of job %s: %v", item.Index, item.JobID, err)
+		}
+	}
+}
@@ -1,7 +1,37 @@
 package llm
 
+import "context"
+
+// Roles of the messages in a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a turn of a conversation.
+type Message struct {
+	Role    string
+	Content string
+}
+
 type Client interface {
 	GetEmbedding(input string, modelName string) ([]float32, error)
-	GetSearchWords(queryString string, modelName string) (string, error)
-	SendPrompt(prompt string, modelName string) (string, error)
+	GetEmbeddings(inputs []string, modelName string) ([][]float32, error)
+	// GetSearchWords turns a question, and the conversation it was asked in, into
+	// at most count standalone search queries
+	GetSearchWords(queryString string, history []string, count int, modelName string) ([]string, error)
+	// GetHypotheticalAnswer writes a plausible answer to a question, to be
+	// embedded in its place for retrieval
+	GetHypotheticalAnswer(queryString string, modelName string) (string, error)
+	// SendPrompt sends prompt after the earlier turns of the conversation in
+	// history and returns the response
+	SendPrompt(prompt string, history []Message, modelName string) (string, error)
+	// StreamPrompt sends prompt like SendPrompt and calls onToken with each
+	// piece of the response as it is generated
+	StreamPrompt(ctx context.Context, prompt string, history []Message, modelName string, onToken func(string) error) (string, error)
+	// Complete sends prompt as the only message, without the system prompt
+	Complete(prompt string, modelName string) (string, error)
+	// ContextBudget returns the number of tokens that can be added to prompt
+	// before it is sent with SendPrompt
+	ContextBudget(prompt string, history []Message, modelName string) int
 }
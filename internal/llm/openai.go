@@ -1,12 +1,25 @@
 package llm
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/tokenizer"
+)
+
+const (
+	DefaultEmbeddingBatchSize   = 64
+	DefaultEmbeddingBatchTokens = 8192
+	DefaultContextWindow        = 8192
+	DefaultAnswerReserveTokens  = 1024
+	DefaultStreamTimeout        = 5 * time.Minute
 )
 
 type OpenAIClient struct {
@@ -14,13 +27,26 @@ type OpenAIClient struct {
 	EmbeddingEndpoint string
 	APIKey            string
 	HTTPClient        *http.Client
-	systemPrompt      string
-	defaultModelName  string
+	// EmbeddingBatchSize caps the number of inputs sent in one embeddings request
+	EmbeddingBatchSize int
+	// EmbeddingBatchTokens caps the tokens sent in one embeddings request
+	EmbeddingBatchTokens int
+	// ContextWindows holds the context window in tokens of known models
+	ContextWindows map[string]int
+	// DefaultContextWindow is used for models missing from ContextWindows
+	DefaultContextWindow int
+	// AnswerReserveTokens is the part of the context window kept free for the answer
+	AnswerReserveTokens int
+	// StreamTimeout bounds a whole streamed response, which takes much longer
+	// than waiting for the first byte of a regular one
+	StreamTimeout    time.Duration
+	systemPrompt     string
+	defaultModelName string
 }
 
 type OpenAIEmbeddingRequest struct {
-	Model string `json:"model"`
-	Input string `json:"input"`
+	Model string   `json:"model"`
+	Input []string `json:"input"`
 }
 
 type OpenAIRequest struct {
@@ -29,6 +55,7 @@ type OpenAIRequest struct {
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature int             `json:"tempurature"`
 	Seed        *int            `json:"seed,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
 }
 
 type OpenAIMessage struct {
@@ -37,6 +64,7 @@ type OpenAIMessage struct {
 }
 
 type OpenAIEmbeddingResponseData struct {
+	Index     int       `json:"index"`
 	Embedding []float32 `json:"embedding"`
 }
 
@@ -50,6 +78,13 @@ type OpenAIResponse struct {
 	} `json:"choices"`
 }
 
+// OpenAIStreamChunk is the data of one server-sent event of a streamed response
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Delta OpenAIMessage `json:"delta"`
+	} `json:"choices"`
+}
+
 func NewOpenAIClient(endpoint string, embeddingEndpoint string, apiKey string, defaultModelName string) *OpenAIClient {
 	systemPrompt, err := os.ReadFile("./system_prompt.txt")
 
@@ -64,25 +99,73 @@ func NewOpenAIClient(endpoint string, embeddingEndpoint string, apiKey string, d
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		defaultModelName: defaultModelName,
-		systemPrompt:     string(systemPrompt),
+		EmbeddingBatchSize:   DefaultEmbeddingBatchSize,
+		EmbeddingBatchTokens: DefaultEmbeddingBatchTokens,
+		ContextWindows:       map[string]int{},
+		DefaultContextWindow: DefaultContextWindow,
+		AnswerReserveTokens:  DefaultAnswerReserveTokens,
+		StreamTimeout:        DefaultStreamTimeout,
+		defaultModelName:     defaultModelName,
+		systemPrompt:         string(systemPrompt),
 	}
 }
 
 func (c *OpenAIClient) GetEmbedding(input string, modelName string) ([]float32, error) {
+	embeddings, err := c.GetEmbeddings([]string{input}, modelName)
+	if err != nil {
+		return []float32{}, err
+	}
+
+	return embeddings[0], nil
+}
+
+// GetEmbeddings embeds many inputs using as few requests as possible. Inputs are
+// grouped into batches limited by EmbeddingBatchSize and EmbeddingBatchTokens and
+// the returned embeddings are in the same order as the inputs.
+func (c *OpenAIClient) GetEmbeddings(inputs []string, modelName string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(inputs))
+
+	for start := 0; start < len(inputs); {
+		end := start
+		tokens := 0
+		for end < len(inputs) {
+			cost := tokenizer.Count(inputs[end])
+
+			// A batch always holds at least one input, however long it is
+			if end > start && (end-start >= c.EmbeddingBatchSize || tokens+cost > c.EmbeddingBatchTokens) {
+				break
+			}
+
+			tokens += cost
+			end++
+		}
+
+		batch, err := c.getEmbeddingBatch(inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		embeddings = append(embeddings, batch...)
+		start = end
+	}
+
+	return embeddings, nil
+}
+
+func (c *OpenAIClient) getEmbeddingBatch(inputs []string) ([][]float32, error) {
 	embeddingRequest := OpenAIEmbeddingRequest{
 		Model: c.defaultModelName,
-		Input: input,
+		Input: inputs,
 	}
 
 	data, err := json.Marshal(embeddingRequest)
 	if err != nil {
-		return []float32{}, err
+		return nil, err
 	}
 
 	req, err := http.NewRequest("POST", c.EmbeddingEndpoint, bytes.NewBuffer(data))
 	if err != nil {
-		return []float32{}, err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -92,30 +175,121 @@ func (c *OpenAIClient) GetEmbedding(input string, modelName string) ([]float32,
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return []float32{}, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return []float32{}, fmt.Errorf("LLM server returned status: %s", resp.Status)
+		return nil, fmt.Errorf("LLM server returned status: %s", resp.Status)
 	}
 
 	var embeddingResponse OpenAIEmbeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&embeddingResponse); err != nil {
-		return []float32{}, err
+		return nil, err
+	}
+
+	if len(embeddingResponse.Data) != len(inputs) {
+		return nil, fmt.Errorf("LLM server returned %d embeddings for %d inputs", len(embeddingResponse.Data), len(inputs))
+	}
+
+	// The server is not required to keep the input order, so use the index field
+	embeddings := make([][]float32, len(inputs))
+	for _, data := range embeddingResponse.Data {
+		if data.Index < 0 || data.Index >= len(inputs) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("LLM server returned an invalid embedding index: %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// ContextBudget returns the number of tokens that can be added to prompt before
+// it is sent with SendPrompt after history, leaving room for the system prompt
+// and the answer.
+func (c *OpenAIClient) ContextBudget(prompt string, history []Message, modelName string) int {
+	if modelName == "" {
+		modelName = c.defaultModelName
+	}
+
+	window, ok := c.ContextWindows[modelName]
+	if !ok {
+		window = c.DefaultContextWindow
+	}
+
+	// Each message costs a few tokens on top of its content
+	const messageOverhead = 4
+	used := tokenizer.Count(c.systemPrompt) + tokenizer.Count(prompt) + 2*messageOverhead
+	for _, message := range history {
+		used += tokenizer.Count(message.Content) + messageOverhead
+	}
+
+	return max(window-used-c.AnswerReserveTokens, 0)
+}
+
+func (c *OpenAIClient) GetSearchWords(queryString string, history []string, count int, modelName string) ([]string, error) {
+	if count < 1 {
+		count = 1
+	}
+
+	content := fmt.Sprintf("Please create up to %d search queries for this question. "+
+		"Each query must make sense on its own, so replace references like \"it\" or \"the second one\" with what they refer to. "+
+		"ONLY give me the search strings, one per line. Do not number them or use quotes: \n\n", count)
+	if len(history) > 0 {
+		content += "Conversation so far:\n" + strings.Join(history, "\n") + "\n\nQuestion: "
+	}
+	content += queryString
+
+	message := OpenAIMessage{
+		Role:    "user",
+		Content: content,
+	}
+
+	if modelName == "" {
+		modelName = c.defaultModelName
+	}
+
+	seedPtr := new(int)
+	*seedPtr = 1234
+
+	reqBody := OpenAIRequest{
+		Model:       modelName,
+		Messages:    []OpenAIMessage{message},
+		MaxTokens:   -1,
+		Temperature: 0,
+		Seed:        seedPtr,
 	}
 
-	if len(embeddingResponse.Data) == 0 {
-		return []float32{}, fmt.Errorf("no response from LLM server")
+	response, err := c.getResponse(&reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{}
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), `"'`)
+		if line == "" {
+			continue
+		}
+		queries = append(queries, line)
+		if len(queries) == count {
+			break
+		}
 	}
 
-	return embeddingResponse.Data[0].Embedding, nil
+	return queries, nil
 }
 
-func (c *OpenAIClient) GetSearchWords(queryString string, modelName string) (string, error) {
+// GetHypotheticalAnswer asks the model to answer a question as a passage from
+// the documentation would. The answer may be wrong; it only needs to read like
+// the documents that hold the real one.
+func (c *OpenAIClient) GetHypotheticalAnswer(queryString string, modelName string) (string, error) {
+	content := "Please write a short passage that answers this question, written the way a technical document on the topic would answer it. " +
+		"If you are unsure, write a plausible answer anyway. ONLY give me the passage: \n\n" + queryString
+
 	message := OpenAIMessage{
 		Role:    "user",
-		Content: "Please create a search query for this. ONLY give me the search string. Do not use quotes: \n\n" + queryString,
+		Content: content,
 	}
 
 	if modelName == "" {
@@ -133,15 +307,72 @@ func (c *OpenAIClient) GetSearchWords(queryString string, modelName string) (str
 		Seed:        seedPtr,
 	}
 
+	response, err := c.getResponse(&reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(response), nil
+}
+
+func (c *OpenAIClient) SendPrompt(prompt string, history []Message, modelName string) (string, error) {
+	if modelName == "" {
+		modelName = c.defaultModelName
+	}
+
+	reqBody := OpenAIRequest{
+		Model:       modelName,
+		Messages:    c.conversation(prompt, history),
+		MaxTokens:   -1,
+		Temperature: 0,
+	}
+
 	return c.getResponse(&reqBody)
 }
 
-func (c *OpenAIClient) SendPrompt(prompt string, modelName string) (string, error) {
-	systemMessage := OpenAIMessage{
+// StreamPrompt sends prompt like SendPrompt, but asks for the response as
+// server-sent events and calls onToken with each piece of text as it arrives.
+// The stream stops early when ctx is done or onToken returns an error. The
+// complete response is returned.
+func (c *OpenAIClient) StreamPrompt(ctx context.Context, prompt string, history []Message, modelName string, onToken func(string) error) (string, error) {
+	if modelName == "" {
+		modelName = c.defaultModelName
+	}
+
+	reqBody := OpenAIRequest{
+		Model:       modelName,
+		Messages:    c.conversation(prompt, history),
+		MaxTokens:   -1,
+		Temperature: 0,
+		Stream:      true,
+	}
+
+	return c.streamResponse(ctx, &reqBody, onToken)
+}
+
+// conversation returns the messages sent for prompt: the system prompt, the
+// earlier turns in history and prompt itself.
+func (c *OpenAIClient) conversation(prompt string, history []Message) []OpenAIMessage {
+	messages := make([]OpenAIMessage, 0, len(history)+2)
+	messages = append(messages, OpenAIMessage{
 		Role:    "system",
 		Content: c.systemPrompt,
+	})
+	for _, message := range history {
+		messages = append(messages, OpenAIMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
 	}
+	messages = append(messages, OpenAIMessage{
+		Role:    RoleUser,
+		Content: prompt,
+	})
+
+	return messages
+}
 
+func (c *OpenAIClient) Complete(prompt string, modelName string) (string, error) {
 	message := OpenAIMessage{
 		Role:    "user",
 		Content: prompt,
@@ -153,7 +384,7 @@ func (c *OpenAIClient) SendPrompt(prompt string, modelName string) (string, erro
 
 	reqBody := OpenAIRequest{
 		Model:       modelName,
-		Messages:    []OpenAIMessage{systemMessage, message},
+		Messages:    []OpenAIMessage{message},
 		MaxTokens:   -1,
 		Temperature: 0,
 	}
@@ -200,3 +431,73 @@ func (c *OpenAIClient) getResponse(reqBody *OpenAIRequest) (string, error) {
 
 	return llmResp.Choices[0].Message.Content, nil
 }
+
+func (c *OpenAIClient) streamResponse(ctx context.Context, reqBody *OpenAIRequest, onToken func(string) error) (string, error) {
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	}
+
+	// The regular timeout would cut off long answers part way through
+	client := *c.HTTPClient
+	client.Timeout = c.StreamTimeout
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("LLM server returned status: %s", resp.Status)
+	}
+
+	var response strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// Events are separated by blank lines; only the data fields matter
+		payload, found := strings.CutPrefix(scanner.Text(), "data:")
+		if !found {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "[DONE]" {
+			break
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return "", fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		response.WriteString(token)
+		if err := onToken(token); err != nil {
+			return "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if response.Len() == 0 {
+		return "", fmt.Errorf("no response from LLM server")
+	}
+
+	return response.String(), nil
+}
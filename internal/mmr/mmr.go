@@ -0,0 +1,100 @@
+package mmr
+
+import (
+	"math"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+// DefaultLambda weighs relevance and diversity equally.
+const DefaultLambda = 0.5
+
+// Rerank orders results by maximal marginal relevance and returns the first k.
+// Each step picks the result maximizing
+//
+//	lambda * relevance - (1 - lambda) * max similarity to the results already picked
+//
+// where relevance is the result's score scaled to [0, 1] across the candidates
+// and similarity is the cosine similarity of the chunk vectors. A lambda of 1
+// keeps the original order and 0 maximizes diversity. Results without a vector
+// are treated as dissimilar to everything.
+func Rerank(results []models.SearchResult, lambda float64, k int) []models.SearchResult {
+	if k <= 0 || k > len(results) {
+		k = len(results)
+	}
+	if len(results) == 0 {
+		return results
+	}
+
+	relevance := normalizeScores(results)
+
+	selected := make([]models.SearchResult, 0, k)
+	// maxSimilarity[i] is the similarity of candidate i to its nearest selected result
+	maxSimilarity := make([]float64, len(results))
+	picked := make([]bool, len(results))
+
+	for len(selected) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i := range results {
+			if picked[i] {
+				continue
+			}
+
+			score := lambda*relevance[i] - (1-lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+
+		picked[best] = true
+		selected = append(selected, results[best])
+
+		for i := range results {
+			if !picked[i] {
+				maxSimilarity[i] = math.Max(maxSimilarity[i], cosineSimilarity(results[i].Vector, results[best].Vector))
+			}
+		}
+	}
+
+	return selected
+}
+
+// normalizeScores scales the scores of results to [0, 1]. Equal scores all
+// become 1.
+func normalizeScores(results []models.SearchResult) []float64 {
+	low, high := results[0].Score, results[0].Score
+	for _, result := range results {
+		low = math.Min(low, result.Score)
+		high = math.Max(high, result.Score)
+	}
+
+	normalized := make([]float64, len(results))
+	for i, result := range results {
+		if high == low {
+			normalized[i] = 1
+		} else {
+			normalized[i] = (result.Score - low) / (high - low)
+		}
+	}
+	return normalized
+}
+
+func cosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
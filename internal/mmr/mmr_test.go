@@ -0,0 +1,106 @@
+package mmr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/models"
+)
+
+func candidate(id int64, score float64, vector ...float32) models.SearchResult {
+	return models.SearchResult{Document: models.Document{ID: id}, Score: score, Vector: vector}
+}
+
+func TestRerank(t *testing.T) {
+	// b is a copy of a, c is different from both
+	a := candidate(1, 1.0, 1, 0)
+	b := candidate(2, 0.9, 1, 0)
+	c := candidate(3, 0.5, 0, 1)
+
+	tests := []struct {
+		name    string
+		results []models.SearchResult
+		lambda  float64
+		k       int
+		want    []int64
+	}{
+		{
+			name:   "empty",
+			lambda: 0.5,
+			k:      3,
+			want:   []int64{},
+		},
+		{
+			name:    "lambda 1 keeps the order",
+			results: []models.SearchResult{a, b, c},
+			lambda:  1,
+			k:       3,
+			want:    []int64{1, 2, 3},
+		},
+		{
+			name:    "duplicates move down",
+			results: []models.SearchResult{a, b, c},
+			lambda:  0.5,
+			k:       3,
+			want:    []int64{1, 3, 2},
+		},
+		{
+			name:    "lambda 0 maximizes diversity",
+			results: []models.SearchResult{a, b, c},
+			lambda:  0,
+			k:       3,
+			want:    []int64{1, 3, 2},
+		},
+		{
+			name:    "k limits the results",
+			results: []models.SearchResult{a, b, c},
+			lambda:  0.5,
+			k:       2,
+			want:    []int64{1, 3},
+		},
+		{
+			name:    "k beyond the results",
+			results: []models.SearchResult{a, c},
+			lambda:  0.5,
+			k:       5,
+			want:    []int64{1, 3},
+		},
+		{
+			name:    "results without vectors keep the order",
+			results: []models.SearchResult{candidate(1, 1.0), candidate(2, 0.9), candidate(3, 0.5)},
+			lambda:  0.5,
+			k:       3,
+			want:    []int64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int64{}
+			for _, result := range Rerank(tt.results, tt.lambda, tt.k) {
+				got = append(got, result.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rerank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRerankPrefix(t *testing.T) {
+	results := []models.SearchResult{
+		candidate(1, 1.0, 1, 0),
+		candidate(2, 0.9, 1, 0.1),
+		candidate(3, 0.8, 0, 1),
+		candidate(4, 0.7, 0.1, 1),
+		candidate(5, 0.6, 1, 1),
+	}
+
+	// Pages cut from one pool rely on a smaller k giving a prefix of a larger one
+	all := Rerank(results, 0.5, len(results))
+	for k := 1; k < len(results); k++ {
+		if got := Rerank(results, 0.5, k); !reflect.DeepEqual(got, all[:k]) {
+			t.Errorf("Rerank(k=%d) = %v, want %v", k, got, all[:k])
+		}
+	}
+}
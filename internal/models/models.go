@@ -3,18 +3,78 @@ package models
 import "time"
 
 type Document struct {
-	ID        int64     `json:"id"`
-	DatasetID int64     `json:"dataset_id"`
-	Title     string    `json:"title"`
-	URL       string    `json:"url,omitempty"`
-	Body      string    `json:"body"`
-	Vec       []float32 `json:"vector"`
+	ID          int64          `json:"id"`
+	DatasetID   int64          `json:"dataset_id"`
+	Dataset     string         `json:"dataset,omitempty"`
+	ExternalID  string         `json:"external_id,omitempty"`
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Body        string         `json:"body"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	ContentHash string         `json:"-"`
+	CreatedAt   time.Time      `json:"-"`
+	UpdatedAt   time.Time      `json:"-"`
 }
 
+// SearchResult is a chunk matched by a search, reported as its parent document
+// with the chunk's text as the body.
+type SearchResult struct {
+	Document
+	ChunkID int64   `json:"-"`
+	Score   float64 `json:"-"`
+	// TokenCount is the number of tokens in Body
+	TokenCount int `json:"-"`
+	// Vector is the chunk's embedding, only loaded when requested
+	Vector []float32 `json:"-"`
+}
+
+// Operators supported by MetadataFilter
+const (
+	FilterEqual        = "eq"
+	FilterIn           = "in"
+	FilterGreater      = "gt"
+	FilterGreaterEqual = "gte"
+	FilterLess         = "lt"
+	FilterLessEqual    = "lte"
+)
+
+// MetadataFilter restricts a search to documents whose metadata value for Key
+// satisfies Op. Range operators compare numbers numerically and strings, such
+// as ISO 8601 dates, lexically.
+type MetadataFilter struct {
+	Key   string
+	Op    string
+	Value any
+}
+
+type Chunk struct {
+	ID         int64     `json:"id"`
+	DocumentID int64     `json:"document_id"`
+	Index      int       `json:"index"`
+	Body       string    `json:"body"`
+	TokenCount int       `json:"token_count"`
+	Vec        []float32 `json:"vector"`
+}
+
+// ChatMessage is one turn of a chat session. The documents retrieved to answer
+// a question are kept with the answer.
+type ChatMessage struct {
+	Role        string    `json:"role"`
+	Content     string    `json:"content"`
+	DocumentIDs []int64   `json:"document_ids,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ChatSession is a conversation of a user. Messages are only loaded for a
+// single session; TurnCount is the number of questions asked in it.
 type ChatSession struct {
-	ID       string   `json:"id"`
-	Messages []string `json:"messages"`
-	Model    string   `json:"model"`
+	ID        string        `json:"id"`
+	Title     string        `json:"title"`
+	Model     string        `json:"model"`
+	Messages  []ChatMessage `json:"messages,omitempty"`
+	TurnCount int           `json:"turn_count"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
 }
 
 type User struct {
@@ -26,4 +86,66 @@ type AccessToken struct {
 	UserID     int64     `json:"id"`
 	Token      string    `json:"token"`
 	Expiration time.Time `json:"expiration"`
+	// Admin is true when the token's user may use the /admin endpoints
+	Admin bool `json:"admin"`
+}
+
+type IngestionJob struct {
+	ID        string              `json:"id"`
+	Status    string              `json:"status"`
+	Total     int                 `json:"total"`
+	Processed int                 `json:"processed"`
+	Failed    int                 `json:"failed"`
+	CreatedAt time.Time           `json:"created_at"`
+	Errors    []IngestionJobError `json:"errors"`
+}
+
+type IngestionJobError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type IngestionJobItem struct {
+	JobID   string
+	UserID  int64
+	Index   int
+	Payload []byte
+	// ClaimedAt identifies the claim the item was returned by
+	ClaimedAt time.Time
+	// Attempts is the number of times the item has been claimed, this one
+	// included
+	Attempts int
+}
+
+// DatasetUpdate holds the changes to a dataset. Nil fields are left unchanged.
+type DatasetUpdate struct {
+	Name           *string
+	Description    *string
+	DistanceMetric *string
+	IndexType      *string
+	HyDEMode       *string
+}
+
+// VectorIndex describes the vector index of a dataset.
+type VectorIndex struct {
+	Dataset    string
+	Name       string
+	Type       string
+	Metric     string
+	Dimensions int
+	Chunks     int
+	SizeBytes  int64
+	Status     string
+}
+
+type Dataset struct {
+	ID             int64
+	Name           string
+	Description    string
+	DistanceMetric string
+	IndexType      string
+	HyDEMode       string
+	DocumentCount  int
+	CreatedAt      time.Time
+	LastUpdated    time.Time
 }
@@ -0,0 +1,81 @@
+package parsing
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOCXParser extracts text from Word (.docx) documents.
+type DOCXParser struct{}
+
+func (DOCXParser) Parse(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: error opening docx archive: %w", ErrInvalidContent, err)
+	}
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		return extractTextFromWordXML(content)
+	}
+
+	return "", fmt.Errorf("%w: docx archive has no word/document.xml", ErrInvalidContent)
+}
+
+// extractTextFromWordXML walks the WordprocessingML body, emitting text runs and
+// turning paragraphs, breaks and tabs into their plain text equivalents.
+func extractTextFromWordXML(content []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+
+	var text strings.Builder
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: could not read docx content: %w", ErrInvalidContent, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			case "tc":
+				text.WriteString("\t")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return normalizeWhitespace(text.String()), nil
+}
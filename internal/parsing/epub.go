@@ -0,0 +1,109 @@
+package parsing
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// EPUBParser extracts the text of every chapter of an EPUB e-book in reading order.
+type EPUBParser struct{}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+func (EPUBParser) Parse(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: error opening epub archive: %w", ErrInvalidContent, err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	// The container points at the package document, which lists the chapters
+	var container epubContainer
+	if err := readZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("%w: epub container has no rootfile", ErrInvalidContent)
+	}
+
+	packagePath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := readZipXML(files, packagePath, &pkg); err != nil {
+		return "", err
+	}
+
+	hrefs := map[string]string{}
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	var chapters []string
+	for _, itemRef := range pkg.Spine {
+		href, ok := hrefs[itemRef.IDRef]
+		if !ok {
+			continue
+		}
+
+		// Manifest hrefs are URL-encoded and relative to the package document
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		file, ok := files[path.Join(path.Dir(packagePath), href)]
+		if !ok {
+			continue
+		}
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		if text := ExtractTextFromHTML(string(content)); text != "" {
+			chapters = append(chapters, text)
+		}
+	}
+
+	return strings.Join(chapters, "\n\n"), nil
+}
+
+func readZipXML(files map[string]*zip.File, name string, v any) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: epub archive has no %s", ErrInvalidContent, name)
+	}
+
+	content, err := readZipFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%w: could not parse %s: %w", ErrInvalidContent, name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package parsing
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// HTMLParser extracts the visible text from HTML and XHTML documents.
+type HTMLParser struct{}
+
+func (HTMLParser) Parse(data []byte) (string, error) {
+	return ExtractTextFromHTML(string(data)), nil
+}
+
+// Elements whose content is never visible text
+var skippedElements = map[string]bool{
+	"head":     true,
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+}
+
+// Elements that start a new line of text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"tr": true, "ul": true,
+}
+
+var (
+	tagNamePattern     = regexp.MustCompile(`^</?\s*([a-zA-Z][a-zA-Z0-9:-]*)`)
+	inlineSpacePattern = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+)
+
+// ExtractTextFromHTML strips markup from an HTML document, keeping line breaks
+// between block elements.
+func ExtractTextFromHTML(document string) string {
+	var text strings.Builder
+	skipping := ""
+
+	for len(document) > 0 {
+		start := strings.IndexByte(document, '<')
+		if start < 0 {
+			if skipping == "" {
+				text.WriteString(html.UnescapeString(document))
+			}
+			break
+		}
+
+		if skipping == "" {
+			text.WriteString(html.UnescapeString(document[:start]))
+		}
+		document = document[start:]
+
+		// Comments, CDATA and doctypes are dropped entirely
+		if strings.HasPrefix(document, "<!--") {
+			end := strings.Index(document, "-->")
+			if end < 0 {
+				break
+			}
+			document = document[end+3:]
+			continue
+		}
+
+		end := strings.IndexByte(document, '>')
+		if end < 0 {
+			break
+		}
+		tag := document[:end+1]
+		document = document[end+1:]
+
+		match := tagNamePattern.FindStringSubmatch(tag)
+		if match == nil {
+			continue
+		}
+		name := strings.ToLower(match[1])
+		closing := strings.HasPrefix(tag, "</")
+		selfClosing := strings.HasSuffix(tag, "/>")
+
+		if skipping != "" {
+			if closing && name == skipping {
+				skipping = ""
+			}
+			continue
+		}
+
+		if !closing && !selfClosing && skippedElements[name] {
+			skipping = name
+			continue
+		}
+
+		switch {
+		case blockElements[name]:
+			text.WriteString("\n")
+		case name == "td" || name == "th":
+			text.WriteString(" ")
+		}
+	}
+
+	return normalizeWhitespace(text.String())
+}
+
+func normalizeWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(inlineSpacePattern.ReplaceAllString(line, " "))
+	}
+
+	text = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,75 @@
+package parsing
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MarkdownParser converts Markdown into plain text by removing its syntax.
+type MarkdownParser struct{}
+
+var (
+	markdownFencePattern    = regexp.MustCompile("^\\s*(```|~~~)")
+	markdownHeadingPattern  = regexp.MustCompile(`^\s{0,3}#{1,6}\s+`)
+	markdownQuotePattern    = regexp.MustCompile(`^\s*(>\s?)+`)
+	markdownListPattern     = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`)
+	markdownRulePattern     = regexp.MustCompile(`^\s*([-*_]\s*){3,}$`)
+	markdownImagePattern    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLinkPattern     = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownRefLinkPattern  = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	markdownRefDefPattern   = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s+\S+`)
+	markdownEmphasisPattern = regexp.MustCompile(`(\*{1,3}|_{1,3}|~~)(\S(?:.*?\S)?)(\*{1,3}|_{1,3}|~~)`)
+	markdownCodePattern     = regexp.MustCompile("`([^`]+)`")
+	markdownTablePattern    = regexp.MustCompile(`^\s*\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+	markdownTagPattern      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+)
+
+func (MarkdownParser) Parse(data []byte) (string, error) {
+	text, err := TextParser{}.Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(text, "\n")
+	output := make([]string, 0, len(lines))
+	inCode := false
+
+	for _, line := range lines {
+		if markdownFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+
+		// Code blocks are kept verbatim
+		if inCode {
+			output = append(output, line)
+			continue
+		}
+
+		if markdownRuleOrDefinition(line) {
+			continue
+		}
+
+		line = markdownHeadingPattern.ReplaceAllString(line, "")
+		line = markdownQuotePattern.ReplaceAllString(line, "")
+		line = markdownListPattern.ReplaceAllString(line, "")
+		line = markdownImagePattern.ReplaceAllString(line, "$1")
+		line = markdownLinkPattern.ReplaceAllString(line, "$1")
+		line = markdownRefLinkPattern.ReplaceAllString(line, "$1")
+		line = markdownCodePattern.ReplaceAllString(line, "$1")
+		line = markdownEmphasisPattern.ReplaceAllString(line, "$2")
+		line = markdownTagPattern.ReplaceAllString(line, "")
+		line = strings.Trim(strings.TrimSpace(line), "|")
+		line = strings.ReplaceAll(line, " | ", " ")
+
+		output = append(output, strings.TrimSpace(line))
+	}
+
+	return normalizeWhitespace(strings.Join(output, "\n")), nil
+}
+
+func markdownRuleOrDefinition(line string) bool {
+	return markdownRulePattern.MatchString(line) ||
+		markdownRefDefPattern.MatchString(line) ||
+		markdownTablePattern.MatchString(line)
+}
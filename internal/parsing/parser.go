@@ -0,0 +1,148 @@
+package parsing
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	MIMETypePDF      = "application/pdf"
+	MIMETypeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MIMETypeEPUB     = "application/epub+zip"
+	MIMETypeHTML     = "text/html"
+	MIMETypeMarkdown = "text/markdown"
+	MIMETypePlain    = "text/plain"
+)
+
+// ErrUnsupportedType is returned when no parser is registered for a file's type.
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+// ErrInvalidContent is returned when a file is corrupt or does not hold what
+// its type promises, such as a text file that is not valid UTF-8.
+var ErrInvalidContent = errors.New("invalid file content")
+
+// Parser extracts plain text from the raw contents of a file.
+type Parser interface {
+	Parse(data []byte) (string, error)
+}
+
+// Registry maps MIME types to the parser that handles them.
+type Registry struct {
+	parsers map[string]Parser
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		parsers: map[string]Parser{},
+	}
+}
+
+// NewDefaultRegistry creates a Registry with parsers for every supported format.
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register(MIMETypePDF, PDFParser{})
+	registry.Register(MIMETypeDOCX, DOCXParser{})
+	registry.Register(MIMETypeEPUB, EPUBParser{})
+	registry.Register(MIMETypeHTML, HTMLParser{})
+	registry.Register(MIMETypeMarkdown, MarkdownParser{})
+	registry.Register(MIMETypePlain, TextParser{})
+
+	return registry
+}
+
+// Register adds a parser for a MIME type, replacing any existing parser for it.
+func (r *Registry) Register(mimeType string, parser Parser) {
+	r.parsers[mimeType] = parser
+}
+
+// Parse detects the type of a file and extracts its text. The detected MIME type
+// is returned along with the text so callers can report it.
+func (r *Registry) Parse(filename string, data []byte) (string, string, error) {
+	mimeType := DetectMIMEType(filename, data)
+
+	parser, ok := r.parsers[mimeType]
+	if !ok {
+		return "", mimeType, fmt.Errorf("%w: %s", ErrUnsupportedType, mimeType)
+	}
+
+	text, err := parser.Parse(data)
+	if err != nil {
+		return "", mimeType, err
+	}
+
+	return text, mimeType, nil
+}
+
+// DetectMIMEType sniffs the type of a file from its contents. The file name is
+// only used to tell apart formats that cannot be distinguished by content, such
+// as Markdown and plain text.
+func DetectMIMEType(filename string, data []byte) string {
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		detected = "application/octet-stream"
+	}
+
+	switch detected {
+	case "application/zip":
+		return detectZipType(data)
+	case MIMETypePlain:
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".md", ".markdown":
+			return MIMETypeMarkdown
+		case ".html", ".htm", ".xhtml":
+			return MIMETypeHTML
+		}
+	case "text/xml":
+		// XHTML documents are sniffed as XML
+		if bytes.Contains(bytes.ToLower(data[:min(len(data), 1024)]), []byte("<html")) {
+			return MIMETypeHTML
+		}
+	}
+
+	return detected
+}
+
+// detectZipType inspects the contents of a zip archive to identify office and
+// e-book formats, which are all zip files underneath.
+func detectZipType(data []byte) string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "application/zip"
+	}
+
+	for _, file := range archive.File {
+		switch file.Name {
+		case "word/document.xml":
+			return MIMETypeDOCX
+		case "mimetype":
+			content, err := readZipFile(file)
+			if err == nil && strings.TrimSpace(string(content)) == MIMETypeEPUB {
+				return MIMETypeEPUB
+			}
+		}
+	}
+
+	return "application/zip"
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not open %s: %w", ErrInvalidContent, file.Name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read %s: %w", ErrInvalidContent, file.Name, err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,106 @@
+package parsing
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// zipFile returns a zip archive holding files with the given names and contents.
+func zipFile(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectMIMEType(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		want     string
+	}{
+		{
+			name:     "pdf",
+			filename: "file.bin",
+			data:     []byte("%PDF-1.7\n%binary"),
+			want:     MIMETypePDF,
+		},
+		{
+			name:     "html",
+			filename: "page.txt",
+			data:     []byte("<!DOCTYPE html><html><body>Hi</body></html>"),
+			want:     MIMETypeHTML,
+		},
+		{
+			name:     "xhtml",
+			filename: "page.xhtml",
+			data:     []byte(`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"></html>`),
+			want:     MIMETypeHTML,
+		},
+		{
+			name:     "plain text",
+			filename: "notes.txt",
+			data:     []byte("Just some notes."),
+			want:     MIMETypePlain,
+		},
+		{
+			name:     "markdown by extension",
+			filename: "README.MD",
+			data:     []byte("# Title\n\nSome text."),
+			want:     MIMETypeMarkdown,
+		},
+		{
+			name:     "html fragment by extension",
+			filename: "fragment.htm",
+			data:     []byte("Some text without tags."),
+			want:     MIMETypeHTML,
+		},
+		{
+			name:     "docx",
+			filename: "file.zip",
+			data:     zipFile(t, map[string]string{"word/document.xml": "<w:document/>"}),
+			want:     MIMETypeDOCX,
+		},
+		{
+			name:     "epub",
+			filename: "book",
+			data:     zipFile(t, map[string]string{"mimetype": MIMETypeEPUB}),
+			want:     MIMETypeEPUB,
+		},
+		{
+			name:     "other zip",
+			filename: "file.docx",
+			data:     zipFile(t, map[string]string{"file.txt": "text"}),
+			want:     "application/zip",
+		},
+		{
+			name:     "binary",
+			filename: "file.txt",
+			data:     []byte{0x00, 0x01, 0x02, 0xff},
+			want:     "application/octet-stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMIMEType(tt.filename, tt.data); got != tt.want {
+				t.Errorf("DetectMIMEType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package parsing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextParser reads plain UTF-8 text files.
+type TextParser struct{}
+
+func (TextParser) Parse(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%w: text file is not valid UTF-8", ErrInvalidContent)
+	}
+
+	return strings.ReplaceAll(string(data), "\r\n", "\n"), nil
+}
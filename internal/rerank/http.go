@@ -0,0 +1,95 @@
+package rerank
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPReranker calls a rerank endpoint using the request and response schema
+// shared by Cohere, Jina and most self-hosted rerank servers.
+type HTTPReranker struct {
+	Endpoint   string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type httpRerankRequest struct {
+	Model           string   `json:"model,omitempty"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+type httpRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func NewHTTPReranker(endpoint string, apiKey string, model string) *HTTPReranker {
+	return &HTTPReranker{
+		Endpoint: endpoint,
+		APIKey:   apiKey,
+		Model:    model,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (r *HTTPReranker) Rerank(query string, documents []string, topK int) ([]Result, error) {
+	if len(documents) == 0 {
+		return []Result{}, nil
+	}
+
+	data, err := json.Marshal(httpRerankRequest{
+		Model:     r.Model,
+		Query:     query,
+		Documents: documents,
+		TopN:      topK,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", r.Endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.APIKey))
+	}
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank server returned status: %s", resp.Status)
+	}
+
+	var rerankResponse httpRerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rerankResponse); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(rerankResponse.Results))
+	for _, result := range rerankResponse.Results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank server returned an invalid index: %d", result.Index)
+		}
+		results = append(results, Result{Index: result.Index, Score: result.RelevanceScore})
+	}
+
+	return topResults(results, topK), nil
+}
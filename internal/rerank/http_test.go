@@ -0,0 +1,106 @@
+package rerank
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHTTPRerankerRerank(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiKey   string
+		status   int
+		response string
+		topK     int
+		want     []Result
+		wantErr  bool
+	}{
+		{
+			name:     "sorts by score",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 0, "relevance_score": 0.1}, {"index": 2, "relevance_score": 0.9}, {"index": 1, "relevance_score": 0.5}]}`,
+			want:     []Result{{Index: 2, Score: 0.9}, {Index: 1, Score: 0.5}, {Index: 0, Score: 0.1}},
+		},
+		{
+			name:     "keeps top k",
+			apiKey:   "secret",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 0, "relevance_score": 0.1}, {"index": 2, "relevance_score": 0.9}, {"index": 1, "relevance_score": 0.5}]}`,
+			topK:     2,
+			want:     []Result{{Index: 2, Score: 0.9}, {Index: 1, Score: 0.5}},
+		},
+		{
+			name:     "error status",
+			status:   http.StatusInternalServerError,
+			response: `{}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid index",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 3, "relevance_score": 0.1}]}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid json",
+			status:   http.StatusOK,
+			response: `not json`,
+			wantErr:  true,
+		},
+	}
+
+	documents := []string{"first", "second", "third"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				wantAuth := ""
+				if tt.apiKey != "" {
+					wantAuth = "Bearer " + tt.apiKey
+				}
+				if got := r.Header.Get("Authorization"); got != wantAuth {
+					t.Errorf("Authorization = %q, want %q", got, wantAuth)
+				}
+
+				var request httpRerankRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("could not decode request: %v", err)
+				}
+				if request.Query != "query" || request.Model != "model" || request.TopN != tt.topK || !reflect.DeepEqual(request.Documents, documents) {
+					t.Errorf("unexpected request: %+v", request)
+				}
+
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			reranker := NewHTTPReranker(server.URL, tt.apiKey, "model")
+			got, err := reranker.Rerank("query", documents, tt.topK)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rerank() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rerank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRerankerRerankNoDocuments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request expected without documents")
+	}))
+	defer server.Close()
+
+	got, err := NewHTTPReranker(server.URL, "", "").Rerank("query", nil, 5)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Rerank() = %v, %v, want no results", got, err)
+	}
+}
@@ -0,0 +1,82 @@
+package rerank
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/llm"
+)
+
+// LLMReranker asks the chat model to rate how relevant each document is to the
+// query. It needs one completion per document, so it is slower than a
+// dedicated rerank model but works with any OpenAI-compatible server.
+type LLMReranker struct {
+	Client llm.Client
+	Model  string
+	// Concurrency is the number of documents scored at the same time
+	Concurrency int
+}
+
+var scorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+func NewLLMReranker(client llm.Client, model string) *LLMReranker {
+	return &LLMReranker{
+		Client:      client,
+		Model:       model,
+		Concurrency: 4,
+	}
+}
+
+func (r *LLMReranker) Rerank(query string, documents []string, topK int) ([]Result, error) {
+	results := make([]Result, len(documents))
+	errs := make([]error, len(documents))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, max(r.Concurrency, 1))
+	for i, document := range documents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			score, err := r.score(query, document)
+			results[i] = Result{Index: i, Score: score}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return topResults(results, topK), nil
+}
+
+func (r *LLMReranker) score(query string, document string) (float64, error) {
+	prompt := "Rate how relevant the passage is to the question on a scale from 0 (irrelevant) to 10 " +
+		"(answers the question). Reply with ONLY the number.\n\n" +
+		"Question: " + query + "\n\nPassage:\n" + document
+
+	response, err := r.Client.Complete(prompt, r.Model)
+	if err != nil {
+		return 0, err
+	}
+
+	match := scorePattern.FindString(response)
+	if match == "" {
+		return 0, fmt.Errorf("could not read a relevance score from %q", response)
+	}
+
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return score / 10, nil
+}
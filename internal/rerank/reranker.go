@@ -0,0 +1,29 @@
+package rerank
+
+import "sort"
+
+// Result is the relevance score of one of the documents passed to Rerank,
+// identified by its position in that slice.
+type Result struct {
+	Index int
+	Score float64
+}
+
+// Reranker scores documents against a query with a more expensive model than
+// the one used for retrieval.
+type Reranker interface {
+	// Rerank returns the topK most relevant documents, most relevant first.
+	Rerank(query string, documents []string, topK int) ([]Result, error)
+}
+
+// topResults sorts results by descending score and keeps the first topK.
+func topResults(results []Result, topK int) []Result {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
@@ -0,0 +1,242 @@
+package snippet
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DefaultLength is the default snippet length in characters.
+const DefaultLength = 200
+
+// Highlight is a query term match, in characters from the start of the snippet.
+type Highlight struct {
+	Start int
+	End   int
+}
+
+// Snippet is a passage of a text around the query terms it matches.
+type Snippet struct {
+	// Offset is the position of the passage in the text, in characters
+	Offset     int
+	Text       string
+	Highlights []Highlight
+	// Fragment is Text as HTML with the matches wrapped in <mark> tags and an
+	// ellipsis where the text was cut off
+	Fragment string
+}
+
+// stopWords are too common to be worth highlighting
+var stopWords = map[string]bool{
+	"an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "can": true, "do": true, "does": true, "for": true, "from": true,
+	"how": true, "in": true, "is": true, "it": true, "of": true, "on": true,
+	"or": true, "the": true, "to": true, "was": true, "what": true, "when": true,
+	"where": true, "which": true, "who": true, "why": true, "with": true,
+}
+
+// minPrefixLength is the shortest term that also matches words it is a prefix
+// of, so that "index" matches "indexes" but "go" does not match "good".
+const minPrefixLength = 4
+
+// word is a run of letters and digits, in characters.
+type word struct {
+	start int
+	end   int
+	text  string
+}
+
+// match is a word matching the query term at index term.
+type match struct {
+	word
+	term int
+}
+
+// Extract returns up to count non-overlapping passages of about length
+// characters from text, picking the ones matching the most distinct query
+// terms. Passages are returned in the order they appear in text. When nothing
+// matches, the start of text is returned without highlights.
+func Extract(text string, query string, length int, count int) []Snippet {
+	if length < 1 {
+		length = DefaultLength
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return []Snippet{}
+	}
+
+	matches := findMatches(runes, queryTerms(query))
+	if len(matches) == 0 {
+		return []Snippet{newSnippet(runes, 0, length, nil)}
+	}
+
+	type window struct {
+		start int
+		score int
+	}
+
+	// Consider a window leading up to each match and rank them by the number
+	// of distinct terms, then total matches, they contain
+	windows := make([]window, 0, len(matches))
+	for _, m := range matches {
+		start := max(min(m.start-length/4, len(runes)-length), 0)
+
+		terms := map[int]bool{}
+		total := 0
+		for _, other := range matches {
+			if other.start >= start && other.end <= start+length {
+				terms[other.term] = true
+				total++
+			}
+		}
+		windows = append(windows, window{start: start, score: len(terms)*len(matches) + total})
+	}
+	slices.SortStableFunc(windows, func(a, b window) int {
+		return b.score - a.score
+	})
+
+	var starts []int
+	for _, w := range windows {
+		overlaps := slices.ContainsFunc(starts, func(start int) bool {
+			return w.start < start+length && start < w.start+length
+		})
+		if !overlaps {
+			starts = append(starts, w.start)
+		}
+		if len(starts) == count {
+			break
+		}
+	}
+	slices.Sort(starts)
+
+	snippets := make([]Snippet, 0, len(starts))
+	for _, start := range starts {
+		snippets = append(snippets, newSnippet(runes, start, length, matches))
+	}
+
+	return snippets
+}
+
+// newSnippet cuts the passage of about length characters at start, moving its
+// edges to whitespace so no words are split, and highlights the matches in it.
+func newSnippet(runes []rune, start int, length int, matches []match) Snippet {
+	end := min(start+length, len(runes))
+
+	// Only give up a little of the passage to avoid splitting a word
+	const slack = 20
+	if start > 0 && !unicode.IsSpace(runes[start-1]) {
+		for i := start; i < min(start+slack, end); i++ {
+			if unicode.IsSpace(runes[i]) {
+				start = i
+				break
+			}
+		}
+	}
+	if end < len(runes) && !unicode.IsSpace(runes[end]) {
+		for i := end; i > max(end-slack, start); i-- {
+			if unicode.IsSpace(runes[i-1]) {
+				end = i
+				break
+			}
+		}
+	}
+	for start < end && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+
+	highlights := []Highlight{}
+	for _, m := range matches {
+		if m.start >= start && m.end <= end {
+			highlights = append(highlights, Highlight{Start: m.start - start, End: m.end - start})
+		}
+	}
+
+	return Snippet{
+		Offset:     start,
+		Text:       string(runes[start:end]),
+		Highlights: highlights,
+		Fragment:   fragment(runes, start, end, highlights),
+	}
+}
+
+// fragment marks up the passage from start to end of text with its highlights.
+func fragment(text []rune, start int, end int, highlights []Highlight) string {
+	passage := text[start:end]
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	position := 0
+	for _, highlight := range highlights {
+		b.WriteString(html.EscapeString(string(passage[position:highlight.Start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(passage[highlight.Start:highlight.End])))
+		b.WriteString("</mark>")
+		position = highlight.End
+	}
+	b.WriteString(html.EscapeString(string(passage[position:])))
+
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// queryTerms returns the distinct lowercase words of query worth highlighting.
+func queryTerms(query string) []string {
+	terms := []string{}
+	for _, w := range splitWords([]rune(query)) {
+		term := strings.ToLower(w.text)
+		if len([]rune(term)) < 2 || stopWords[term] || slices.Contains(terms, term) {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// findMatches returns the words of text matching a term, in order.
+func findMatches(text []rune, terms []string) []match {
+	matches := []match{}
+	for _, w := range splitWords(text) {
+		lower := strings.ToLower(w.text)
+		for i, term := range terms {
+			if lower == term || (len([]rune(term)) >= minPrefixLength && strings.HasPrefix(lower, term)) {
+				matches = append(matches, match{word: w, term: i})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// splitWords returns the runs of letters and digits in text.
+func splitWords(text []rune) []word {
+	words := []word{}
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		}
+		if !isWordRune && start >= 0 {
+			words = append(words, word{start: start, end: i, text: string(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start: start, end: len(text), text: string(text[start:])})
+	}
+	return words
+}
@@ -0,0 +1,123 @@
+package snippet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	long := strings.Repeat("filler words here. ", 20)
+
+	tests := []struct {
+		name   string
+		text   string
+		query  string
+		length int
+		count  int
+		want   []Snippet
+	}{
+		{
+			name:  "empty text",
+			query: "go",
+			want:  []Snippet{},
+		},
+		{
+			name:  "highlights matches",
+			text:  "Go is a programming language.",
+			query: "go language",
+			want: []Snippet{{
+				Offset:     0,
+				Text:       "Go is a programming language.",
+				Highlights: []Highlight{{Start: 0, End: 2}, {Start: 20, End: 28}},
+				Fragment:   "<mark>Go</mark> is a programming <mark>language</mark>.",
+			}},
+		},
+		{
+			name:  "long terms match as prefixes",
+			text:  "Indexes are rebuilt. Good to go.",
+			query: "index goo",
+			want: []Snippet{{
+				Offset:     0,
+				Text:       "Indexes are rebuilt. Good to go.",
+				Highlights: []Highlight{{Start: 0, End: 7}},
+				Fragment:   "<mark>Indexes</mark> are rebuilt. Good to go.",
+			}},
+		},
+		{
+			name:  "stop words are not highlighted",
+			text:  "The cat is on the mat.",
+			query: "the cat is on",
+			want: []Snippet{{
+				Offset:     0,
+				Text:       "The cat is on the mat.",
+				Highlights: []Highlight{{Start: 4, End: 7}},
+				Fragment:   "The <mark>cat</mark> is on the mat.",
+			}},
+		},
+		{
+			name:   "no match returns the start",
+			text:   "alpha beta gamma delta",
+			query:  "omega",
+			length: 11,
+			want: []Snippet{{
+				Offset:     0,
+				Text:       "alpha beta",
+				Highlights: []Highlight{},
+				Fragment:   "alpha beta…",
+			}},
+		},
+		{
+			name:   "cuts around the match on whitespace",
+			text:   long + "the needle is here. " + long,
+			query:  "needle",
+			length: 30,
+			want: []Snippet{{
+				Offset:     380,
+				Text:       "the needle is here. filler",
+				Highlights: []Highlight{{Start: 4, End: 10}},
+				Fragment:   "…the <mark>needle</mark> is here. filler…",
+			}},
+		},
+		{
+			name:   "several passages in text order",
+			text:   "apple one. " + long + "banana two.",
+			query:  "banana apple",
+			length: 12,
+			count:  2,
+			want: []Snippet{
+				{
+					Offset:     0,
+					Text:       "apple one.",
+					Highlights: []Highlight{{Start: 0, End: 5}},
+					Fragment:   "<mark>apple</mark> one.…",
+				},
+				{
+					Offset:     391,
+					Text:       "banana",
+					Highlights: []Highlight{{Start: 0, End: 6}},
+					Fragment:   "…<mark>banana</mark>…",
+				},
+			},
+		},
+		{
+			name:  "escapes html",
+			text:  "a <b>tag</b> & more",
+			query: "tag",
+			want: []Snippet{{
+				Offset:     0,
+				Text:       "a <b>tag</b> & more",
+				Highlights: []Highlight{{Start: 5, End: 8}},
+				Fragment:   "a &lt;b&gt;<mark>tag</mark>&lt;/b&gt; &amp; more",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract(tt.text, tt.query, tt.length, tt.count); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
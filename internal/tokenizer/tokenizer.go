@@ -0,0 +1,41 @@
+package tokenizer
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Encoding is the BPE encoding used to count tokens. Models served through
+// other tokenizers are counted with it too, which is close enough for budgeting.
+const Encoding = "cl100k_base"
+
+var (
+	loadOnce sync.Once
+	encoding *tiktoken.Tiktoken
+)
+
+// load reads the encoding from the ranks embedded in the binary, so counting
+// never needs network access.
+func load() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+
+	var err error
+	encoding, err = tiktoken.GetEncoding(Encoding)
+	if err != nil {
+		log.Printf("Failed to load the %s tokenizer, estimating token counts instead: %v", Encoding, err)
+	}
+}
+
+// Count returns the number of tokens in text.
+func Count(text string) int {
+	loadOnce.Do(load)
+
+	if encoding == nil {
+		// Roughly four characters per token for English text
+		return len(text)/4 + 1
+	}
+	return len(encoding.EncodeOrdinary(text))
+}
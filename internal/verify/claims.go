@@ -0,0 +1,98 @@
+package verify
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/mrhollen/KnowledgeGPT/internal/llm"
+)
+
+// Claim is a sentence of an answer together with the text of a document it
+// cites.
+type Claim struct {
+	Sentence      string
+	DocumentTitle string
+	DocumentText  string
+}
+
+// Results of checking a claim. VerdictUnknown means no verdict could be had
+// from the LLM.
+const (
+	VerdictSupported   = "supported"
+	VerdictUnsupported = "unsupported"
+	VerdictUnknown     = "unknown"
+)
+
+// Verdict is the outcome of checking a claim against its document.
+type Verdict struct {
+	Result      string
+	Explanation string
+}
+
+// ClaimChecker asks the chat model whether cited documents support the claims
+// citing them. It needs one completion per claim.
+type ClaimChecker struct {
+	Client llm.Client
+	// Concurrency is the number of claims checked at the same time
+	Concurrency int
+}
+
+func NewClaimChecker(client llm.Client) *ClaimChecker {
+	return &ClaimChecker{
+		Client:      client,
+		Concurrency: 4,
+	}
+}
+
+// Check returns a verdict for each claim, in the same order. A claim the LLM
+// could not be asked about, or whose reply could not be read, gets an unknown
+// verdict rather than failing the others.
+func (c *ClaimChecker) Check(claims []Claim, model string) []Verdict {
+	verdicts := make([]Verdict, len(claims))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, max(c.Concurrency, 1))
+	for i, claim := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			verdict, err := c.check(claim, model)
+			if err != nil {
+				log.Printf("Error checking claim %q: %v", claim.Sentence, err)
+				verdict = Verdict{Result: VerdictUnknown}
+			}
+			verdicts[i] = verdict
+		}()
+	}
+	wg.Wait()
+
+	return verdicts
+}
+
+func (c *ClaimChecker) check(claim Claim, model string) (Verdict, error) {
+	prompt := "Does the document support the claim? Reply with SUPPORTED or UNSUPPORTED on the first line, " +
+		"followed by one sentence explaining why.\n\n" +
+		"Claim: " + claim.Sentence + "\n\nDocument: " + claim.DocumentTitle + "\n" + claim.DocumentText
+
+	response, err := c.Client.Complete(prompt, model)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	answer, explanation, _ := strings.Cut(strings.TrimSpace(response), "\n")
+	answer = strings.ToUpper(answer)
+	// Check the negative first since it contains the positive
+	switch {
+	case strings.Contains(answer, "UNSUPPORTED"):
+		return Verdict{Result: VerdictUnsupported, Explanation: strings.TrimSpace(explanation)}, nil
+	case strings.Contains(answer, "SUPPORTED"):
+		return Verdict{Result: VerdictSupported, Explanation: strings.TrimSpace(explanation)}, nil
+	default:
+		return Verdict{}, fmt.Errorf("could not read a verdict from %q", response)
+	}
+}
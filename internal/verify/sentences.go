@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// minClaimWords is the number of words a sentence needs before it is expected
+// to cite a source. Shorter ones are usually transitions like "In short:".
+const minClaimWords = 4
+
+// Sentence is a sentence of an answer with the citation markers removed.
+type Sentence struct {
+	Text string
+	// DocumentIDs are the documents the sentence cites, in order
+	DocumentIDs []int64
+}
+
+// NeedsCitation reports whether the sentence makes a claim that should cite a
+// source. Short sentences, questions and lead-ins ending in a colon do not.
+func (s Sentence) NeedsCitation() bool {
+	if strings.HasSuffix(s.Text, "?") || strings.HasSuffix(s.Text, ":") {
+		return false
+	}
+	return len(strings.Fields(s.Text)) >= minClaimWords
+}
+
+// Markers around the document ID of a citation, see CitationPattern
+const (
+	CitationOpen  = "[citation]"
+	CitationClose = "[/citation]"
+)
+
+// CitationPattern matches the citation markers the system prompt asks for,
+// capturing the ID of the cited document
+var CitationPattern = regexp.MustCompile(regexp.QuoteMeta(CitationOpen) + `(\d+)` + regexp.QuoteMeta(CitationClose))
+
+// sentenceEnd matches the end of a sentence along with the citations placed
+// right after it, which belong to the sentence they follow
+var sentenceEnd = regexp.MustCompile(`[.!?]+(\s*` + CitationPattern.String() + `)*(\s+|$)`)
+
+// listMarker matches the bullet or number starting a list item
+var listMarker = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+
+// Sentences splits an answer with citation markers into its sentences. Every
+// line is split separately, so list items are sentences of their own, and
+// headings and code blocks are skipped.
+func Sentences(answer string) []Sentence {
+	answer = strings.ReplaceAll(answer, "\\n", "\n")
+
+	sentences := []Sentence{}
+	inCode := false
+	for _, line := range strings.Split(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		line = listMarker.ReplaceAllString(line, "")
+
+		start := 0
+		for _, end := range sentenceEnd.FindAllStringIndex(line, -1) {
+			sentences = appendSentence(sentences, line[start:end[1]])
+			start = end[1]
+		}
+		sentences = appendSentence(sentences, line[start:])
+	}
+
+	return sentences
+}
+
+// appendSentence adds the text to sentences unless it is empty, moving its
+// citation markers to DocumentIDs.
+func appendSentence(sentences []Sentence, text string) []Sentence {
+	var ids []int64
+	for _, match := range CitationPattern.FindAllStringSubmatch(text, -1) {
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	text = strings.Join(strings.Fields(CitationPattern.ReplaceAllString(text, "")), " ")
+	// Markers placed before the full stop leave a space in front of it
+	text = strings.NewReplacer(" .", ".", " !", "!", " ?", "?", " ,", ",").Replace(text)
+	if text == "" {
+		return sentences
+	}
+
+	return append(sentences, Sentence{Text: text, DocumentIDs: ids})
+}
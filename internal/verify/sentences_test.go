@@ -0,0 +1,87 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   []Sentence
+	}{
+		{
+			name:   "empty",
+			answer: "",
+			want:   []Sentence{},
+		},
+		{
+			name:   "citations after the full stop",
+			answer: "Go is fast. [citation]1[/citation] It compiles quickly.[citation]2[/citation][citation]3[/citation]",
+			want: []Sentence{
+				{Text: "Go is fast.", DocumentIDs: []int64{1}},
+				{Text: "It compiles quickly.", DocumentIDs: []int64{2, 3}},
+			},
+		},
+		{
+			name:   "citations before the full stop",
+			answer: "Go is fast [citation]1[/citation]. Really.",
+			want: []Sentence{
+				{Text: "Go is fast.", DocumentIDs: []int64{1}},
+				{Text: "Really."},
+			},
+		},
+		{
+			name:   "list items and escaped newlines",
+			answer: `Features:\n- Fast builds [citation]4[/citation]\n2. Garbage collected`,
+			want: []Sentence{
+				{Text: "Features:"},
+				{Text: "Fast builds", DocumentIDs: []int64{4}},
+				{Text: "Garbage collected"},
+			},
+		},
+		{
+			name:   "headings and code are skipped",
+			answer: "# Summary\n```\nfmt.Println(\"hi. there\")\n```\nDone here.",
+			want: []Sentence{
+				{Text: "Done here."},
+			},
+		},
+		{
+			name:   "other punctuation",
+			answer: "Is it fast?! Yes, very fast[citation]5[/citation] !",
+			want: []Sentence{
+				{Text: "Is it fast?!"},
+				{Text: "Yes, very fast!", DocumentIDs: []int64{5}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sentences() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentenceNeedsCitation(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "Go compiles to native code.", want: true},
+		{text: "In short:", want: false},
+		{text: "Here is what matters most:", want: false},
+		{text: "Why does Go compile quickly?", want: false},
+		{text: "Very fast.", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := (Sentence{Text: tt.text}).NeedsCitation(); got != tt.want {
+			t.Errorf("NeedsCitation(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+-- Moves document embeddings into a separate chunks table.
+-- Existing documents keep their single embedding as chunk 0.
+
+CREATE TABLE chunks (
+	id serial4 NOT NULL,
+	document_id int4 NOT NULL,
+	chunk_index int4 NOT NULL,
+	body text NOT NULL,
+	vector public.vector NOT NULL,
+	CONSTRAINT chunks_pkey PRIMARY KEY (id),
+	CONSTRAINT chunks_unique UNIQUE (document_id, chunk_index),
+	CONSTRAINT chunks_documents_fk 
+		FOREIGN KEY (document_id) 
+		REFERENCES documents(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+INSERT INTO chunks (document_id, chunk_index, body, vector)
+SELECT id, 0, body, vector FROM documents;
+
+ALTER TABLE documents DROP COLUMN vector;
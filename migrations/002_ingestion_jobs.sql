@@ -0,0 +1,24 @@
+-- Adds the tables backing asynchronous bulk ingestion jobs.
+
+CREATE TABLE ingestion_jobs (
+	id text NOT NULL,
+	user_id int4 NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT ingestion_jobs_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE ingestion_job_items (
+	job_id text NOT NULL,
+	item_index int4 NOT NULL,
+	payload jsonb NOT NULL,
+	status text DEFAULT 'pending' NOT NULL,
+	error text NULL,
+	document_id int4 NULL,
+	CONSTRAINT ingestion_job_items_pkey PRIMARY KEY (job_id, item_index),
+	CONSTRAINT ingestion_job_items_jobs_fk 
+		FOREIGN KEY (job_id) 
+		REFERENCES ingestion_jobs(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX ingestion_job_items_status_idx ON ingestion_job_items (status);
@@ -0,0 +1,21 @@
+-- Adds content hashes and external IDs to documents so re-ingesting the same
+-- content is a no-op. Existing duplicates are removed, keeping the oldest copy.
+
+ALTER TABLE documents ADD COLUMN external_id text NULL;
+ALTER TABLE documents ADD COLUMN content_hash text NULL;
+
+UPDATE documents SET content_hash = encode(sha256(convert_to(body, 'UTF8')), 'hex');
+
+ALTER TABLE documents ALTER COLUMN content_hash SET NOT NULL;
+
+DELETE FROM documents duplicate
+USING documents original
+WHERE duplicate.dataset_id = original.dataset_id
+	AND duplicate.content_hash = original.content_hash
+	AND duplicate.id > original.id;
+
+ALTER TABLE documents ADD CONSTRAINT documents_external_id_unique UNIQUE (dataset_id, external_id);
+
+CREATE UNIQUE INDEX documents_content_hash_unique 
+	ON documents (dataset_id, content_hash) 
+	WHERE external_id IS NULL;
@@ -0,0 +1,4 @@
+-- Tracks when documents are created and last changed.
+
+ALTER TABLE documents ADD COLUMN created_at timestamp DEFAULT now() NOT NULL;
+ALTER TABLE documents ADD COLUMN updated_at timestamp DEFAULT now() NOT NULL;
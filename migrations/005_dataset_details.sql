@@ -0,0 +1,4 @@
+-- Adds a description and creation time to datasets.
+
+ALTER TABLE datasets ADD COLUMN description text NULL;
+ALTER TABLE datasets ADD COLUMN created_at timestamp DEFAULT now() NOT NULL;
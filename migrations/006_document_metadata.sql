@@ -0,0 +1,5 @@
+-- Adds filterable metadata to documents.
+
+ALTER TABLE documents ADD COLUMN metadata jsonb DEFAULT '{}'::jsonb NOT NULL;
+
+CREATE INDEX documents_metadata_idx ON documents USING gin (metadata);
@@ -0,0 +1,9 @@
+-- Adds full-text search columns for lexical and hybrid search.
+
+ALTER TABLE documents ADD COLUMN title_tsv tsvector 
+	GENERATED ALWAYS AS (setweight(to_tsvector('english', title), 'A')) STORED;
+
+ALTER TABLE chunks ADD COLUMN tsv tsvector 
+	GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX chunks_tsv_idx ON chunks USING gin (tsv);
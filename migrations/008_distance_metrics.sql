@@ -0,0 +1,23 @@
+-- Adds a distance metric per dataset and stores the dataset on each chunk so
+-- every dataset can have a vector index matching its metric.
+
+ALTER TABLE datasets ADD COLUMN distance_metric text DEFAULT 'l2' NOT NULL;
+ALTER TABLE datasets ADD CONSTRAINT datasets_distance_metric_check 
+	CHECK (distance_metric IN ('l2', 'cosine', 'inner_product'));
+ALTER TABLE datasets ADD COLUMN vector_dimensions int4 NULL;
+
+ALTER TABLE chunks ADD COLUMN dataset_id int4 NULL;
+
+UPDATE chunks
+SET dataset_id = documents.dataset_id
+FROM documents
+WHERE documents.id = chunks.document_id;
+
+ALTER TABLE chunks ALTER COLUMN dataset_id SET NOT NULL;
+ALTER TABLE chunks ADD CONSTRAINT chunks_datasets_fk 
+	FOREIGN KEY (dataset_id) 
+	REFERENCES datasets(id) 
+	ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- Existing datasets get their vector index the next time a document is added
+-- to them.
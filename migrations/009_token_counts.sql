@@ -0,0 +1,5 @@
+-- Stores the number of tokens in each chunk, counted at ingest, for budgeting
+-- the LLM context. Chunks stored before this migration have no count and are
+-- estimated from their length until their document is re-ingested.
+
+ALTER TABLE chunks ADD COLUMN token_count int4 NULL;
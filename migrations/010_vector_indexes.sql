@@ -0,0 +1,8 @@
+-- Lets each dataset choose its vector index type.
+
+ALTER TABLE datasets ADD COLUMN vector_index_type text DEFAULT 'hnsw' NOT NULL;
+ALTER TABLE datasets ADD CONSTRAINT datasets_vector_index_type_check 
+	CHECK (vector_index_type IN ('hnsw', 'ivfflat', 'none'));
+
+-- Datasets that existed before 008_distance_metrics.sql have no vector index
+-- yet. Build them with: go run ./cmd/reindex
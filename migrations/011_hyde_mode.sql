@@ -0,0 +1,5 @@
+-- Lets each dataset retrieve with hypothetical document embeddings by default.
+
+ALTER TABLE datasets ADD COLUMN hyde_mode text DEFAULT 'off' NOT NULL;
+ALTER TABLE datasets ADD CONSTRAINT datasets_hyde_mode_check 
+	CHECK (hyde_mode IN ('off', 'hypothetical', 'average'));
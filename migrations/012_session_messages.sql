@@ -0,0 +1,60 @@
+-- Moves the messages of chat sessions out of the sessions.messages array into
+-- their own table, and adds titles and timestamps to sessions.
+
+ALTER TABLE sessions ADD COLUMN title text NULL;
+ALTER TABLE sessions ADD COLUMN created_at timestamp DEFAULT now() NOT NULL;
+ALTER TABLE sessions ADD COLUMN updated_at timestamp DEFAULT now() NOT NULL;
+
+CREATE TABLE session_messages (
+	id serial4 NOT NULL,
+	session_id text NOT NULL,
+	"role" text NOT NULL,
+	"content" text NOT NULL,
+	document_ids _int4 DEFAULT '{}' NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT session_messages_pkey PRIMARY KEY (id),
+	CONSTRAINT session_messages_role_check CHECK (role IN ('user', 'assistant')),
+	CONSTRAINT session_messages_sessions_fk 
+		FOREIGN KEY (session_id) 
+		REFERENCES sessions(id) 
+		ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX session_messages_session_id_idx ON session_messages (session_id, id);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id, updated_at);
+
+-- Messages were stored as JSON objects with role, content and document_ids.
+-- Anything else predates that and is kept as a question.
+WITH messages AS (
+	SELECT
+		sessions.id AS session_id,
+		message.value,
+		message.position,
+		message.value LIKE '{%' AS is_json
+	FROM sessions
+	CROSS JOIN LATERAL unnest(sessions.messages) WITH ORDINALITY AS message(value, position)
+)
+INSERT INTO session_messages (session_id, "role", "content", document_ids)
+SELECT
+	session_id,
+	CASE WHEN is_json THEN value::jsonb ->> 'role' ELSE 'user' END,
+	CASE WHEN is_json THEN value::jsonb ->> 'content' ELSE value END,
+	CASE WHEN is_json 
+		THEN ARRAY(SELECT jsonb_array_elements_text(COALESCE(value::jsonb -> 'document_ids', '[]'::jsonb))::int4)
+		ELSE '{}'
+	END
+FROM messages
+ORDER BY session_id, position;
+
+-- Sessions are titled with their first question
+UPDATE sessions
+SET title = left(first_question."content", 80)
+FROM (
+	SELECT DISTINCT ON (session_id) session_id, "content"
+	FROM session_messages
+	WHERE "role" = 'user'
+	ORDER BY session_id, id
+) AS first_question
+WHERE first_question.session_id = sessions.id;
+
+ALTER TABLE sessions DROP COLUMN messages;
@@ -0,0 +1,5 @@
+-- Records when ingestion job items were claimed, so items are only taken over
+-- once their claim has expired instead of while another server is still
+-- processing them.
+
+ALTER TABLE ingestion_job_items ADD COLUMN claimed_at timestamp NULL;
@@ -0,0 +1,14 @@
+-- Makes content hashes unique within a dataset whatever the external ID, so the
+-- same content posted under another external ID is not stored twice. Existing
+-- duplicates are removed, keeping the oldest copy.
+
+DELETE FROM documents duplicate
+USING documents original
+WHERE duplicate.dataset_id = original.dataset_id
+	AND duplicate.content_hash = original.content_hash
+	AND duplicate.id > original.id;
+
+DROP INDEX documents_content_hash_unique;
+
+CREATE UNIQUE INDEX documents_content_hash_unique 
+	ON documents (dataset_id, content_hash);
@@ -0,0 +1,5 @@
+-- Indexes document titles for full-text search, so lexical searches can match
+-- titles and chunk bodies through their own indexes instead of scanning every
+-- chunk.
+
+CREATE INDEX documents_title_tsv_idx ON documents USING gin (title_tsv);
@@ -0,0 +1,3 @@
+-- Marks the users allowed to use the /admin endpoints.
+
+ALTER TABLE users ADD COLUMN is_admin bool DEFAULT false NOT NULL;
@@ -0,0 +1,6 @@
+-- Counts how often each ingestion job item was claimed and delays the next
+-- claim of items requeued after a temporary failure, such as an unreachable
+-- embedding API.
+
+ALTER TABLE ingestion_job_items ADD COLUMN attempts int4 DEFAULT 0 NOT NULL;
+ALTER TABLE ingestion_job_items ADD COLUMN retry_at timestamp NULL;